@@ -0,0 +1,132 @@
+package whcypher
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Alphabet is the ordered set of letters a trie can hold. Letters are case
+// insensitive and stored lower case. Letters outside ASCII are compared as
+// single runes, so sources and phrases should use the same Unicode
+// normalisation, such as NFC.
+type Alphabet struct {
+	letters []rune
+	ascii   [unicode.MaxASCII + 1]int16
+	other   map[rune]int
+}
+
+var (
+	// AlphabetLatin is the lower case letters a to z, the default.
+	AlphabetLatin = MustAlphabet("abcdefghijklmnopqrstuvwxyz")
+	// AlphabetLatinDigits is AlphabetLatin and the digits 0 to 9.
+	AlphabetLatinDigits = MustAlphabet("abcdefghijklmnopqrstuvwxyz0123456789")
+	// AlphabetGerman is AlphabetLatin and ä, ö, ü and ß.
+	AlphabetGerman = MustAlphabet("abcdefghijklmnopqrstuvwxyzäöüß")
+	// AlphabetSpanish is AlphabetLatin and ñ, the accented vowels and ü.
+	AlphabetSpanish = MustAlphabet("abcdefghijklmnopqrstuvwxyzñáéíóúü")
+)
+
+// NewAlphabet returns an alphabet of the given letters. Letters must be
+// printable runes other than space and appear only once.
+func NewAlphabet(letters string) (*Alphabet, error) {
+	a := &Alphabet{other: map[rune]int{}}
+	for i := range a.ascii {
+		a.ascii[i] = -1
+	}
+
+	for _, r := range strings.ToLower(letters) {
+		if r == utf8.RuneError || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return nil, errors.New("invalid alphabet letter: " + string(r))
+		}
+		if a.Contains(r) {
+			return nil, errors.New("duplicate alphabet letter: " + string(r))
+		}
+		if r <= unicode.MaxASCII {
+			a.ascii[r] = int16(len(a.letters))
+		} else {
+			a.other[r] = len(a.letters)
+		}
+		a.letters = append(a.letters, r)
+	}
+	if len(a.letters) == 0 {
+		return nil, errors.New("empty alphabet")
+	}
+	return a, nil
+}
+
+// MustAlphabet is NewAlphabet that panics on error.
+func MustAlphabet(letters string) *Alphabet {
+	a, err := NewAlphabet(letters)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Len returns the number of letters.
+func (a *Alphabet) Len() int {
+	return len(a.letters)
+}
+
+// String returns the letters in order.
+func (a *Alphabet) String() string {
+	return string(a.letters)
+}
+
+// Index returns the position of the letter in the alphabet, ignoring case.
+func (a *Alphabet) Index(r rune) (int, bool) {
+	r = unicode.ToLower(r)
+	if r < 0 {
+		return -1, false
+	}
+	if r <= unicode.MaxASCII {
+		if a.ascii[r] < 0 {
+			return -1, false
+		}
+		return int(a.ascii[r]), true
+	}
+	i, ok := a.other[r]
+	if !ok {
+		return -1, false
+	}
+	return i, true
+}
+
+// Contains reports whether the letter is in the alphabet, ignoring case.
+func (a *Alphabet) Contains(r rune) bool {
+	_, ok := a.Index(r)
+	return ok
+}
+
+// Filter lower cases the phrase and removes everything that is not in the
+// alphabet, such as punctuation. Letters outside the alphabet are removed
+// too, so phrases about to be encoded should not be filtered with it.
+func (a *Alphabet) Filter(phrase string) string {
+	return strings.Map(func(r rune) rune {
+		if !a.Contains(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, phrase)
+}
+
+// AlphabetOf returns the alphabet of every letter in the source, in order of
+// first appearance.
+func AlphabetOf(source Source) (*Alphabet, error) {
+	seen := map[rune]bool{}
+	letters := []rune{}
+	for _, page := range source {
+		for _, row := range page {
+			for _, r := range row {
+				r = unicode.ToLower(r)
+				if !seen[r] {
+					seen[r] = true
+					letters = append(letters, r)
+				}
+			}
+		}
+	}
+	return NewAlphabet(string(letters))
+}
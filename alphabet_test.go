@@ -0,0 +1,151 @@
+package whcypher
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAlphabet(t *testing.T) {
+	testCases := []struct {
+		letters   string
+		expectErr bool
+	}{
+		{letters: "abc"},
+		{letters: "ABC123#"},
+		{letters: "", expectErr: true},
+		{letters: "aba", expectErr: true},
+		{letters: "aA", expectErr: true},
+		{letters: "a b", expectErr: true},
+		{letters: "aäßñ"},
+		{letters: "äÄ", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.letters, func(t *testing.T) {
+			a, err := NewAlphabet(tc.letters)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if n := utf8.RuneCountInString(tc.letters); a.Len() != n {
+				t.Errorf("Expected %d letters, got %d", n, a.Len())
+			}
+		})
+	}
+}
+
+func TestAlphabet_Index(t *testing.T) {
+	a := MustAlphabet("xyz09")
+	if i, ok := a.Index('Y'); !ok || i != 1 {
+		t.Errorf("Expected Y at 1, got %d %v", i, ok)
+	}
+	if i, ok := a.Index('9'); !ok || i != 4 {
+		t.Errorf("Expected 9 at 4, got %d %v", i, ok)
+	}
+	if _, ok := a.Index('a'); ok {
+		t.Error("Expected a to not be in the alphabet")
+	}
+	if _, ok := a.Index('é'); ok {
+		t.Error("Expected é to not be in the alphabet")
+	}
+	if i, ok := AlphabetGerman.Index('Ä'); !ok || i != 26 {
+		t.Errorf("Expected Ä at 26, got %d %v", i, ok)
+	}
+}
+
+func TestAlphabet_Filter(t *testing.T) {
+	if s := AlphabetSpanish.Filter("¡Mañana, Señor!"); s != "mañanaseñor" {
+		t.Errorf("Expected mañanaseñor, got %q", s)
+	}
+}
+
+func TestAlphabetOf(t *testing.T) {
+	a, err := AlphabetOf(Source{{[]rune("Straße"), []rune("süß")}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if a.String() != "straßeü" {
+		t.Errorf("Expected straßeü, got %q", a.String())
+	}
+}
+
+func TestTrie_Alphabet_Digits(t *testing.T) {
+	source := Source{{[]rune("grid7b"), []rune("at0900")}}
+
+	if _, err := NewTrieFromSource(source, DirectionRight); err == nil {
+		t.Error("Expected invalid character error with the default alphabet, got nil")
+	}
+
+	trie := NewTrieWithAlphabet(AlphabetLatinDigits)
+	if err := trie.InsertSource(source, DirectionRight); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := trie.EncodeOptimal("Grid 7B at 0900", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []Location{{Page: 0, Row: 0, Col: 0, Len: 6, Dir: DirectionRight}, {Page: 0, Row: 1, Col: 0, Len: 6, Dir: DirectionRight}}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+
+	decoded, err := DecodeLocations(source, result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if decoded != "grid7bat0900" {
+		t.Errorf("Expected grid7bat0900, got %q", decoded)
+	}
+}
+
+func TestTrie_SearchLetters_OutsideAlphabet(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abc")
+	if index, _ := trie.SearchLetters("ab1", DirectionRight); index != 2 {
+		t.Errorf("Expected search to stop at 2, got %d", index)
+	}
+}
+
+func TestTrie_Alphabet_Unicode(t *testing.T) {
+	source, err := ParseSource(strings.NewReader("xßträ\nöniño\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	alphabet, err := AlphabetOf(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie := NewTrieWithAlphabet(alphabet)
+	if err := trie.InsertSource(source, DirectionRight); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := trie.EncodeOptimal("Träß Niño", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []Location{
+		{Page: 0, Row: 0, Col: 2, Len: 3, Dir: DirectionRight},
+		{Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight},
+		{Page: 0, Row: 1, Col: 1, Len: 4, Dir: DirectionRight},
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+
+	decoded, err := DecodeLocations(source, result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if decoded != "träßniño" {
+		t.Errorf("Expected träßniño, got %q", decoded)
+	}
+}
@@ -0,0 +1,131 @@
+package whcypher
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+)
+
+// EncodeAlternatives returns up to k encodings of the phrase, each splitting
+// it into runs differently, fewest runs first. Runs respect MinLen and MaxLen
+// from opts and locations are chosen by the trie's selector. Location
+// constraints are not supported, though an empty ledger is allowed.
+func (t *Trie) EncodeAlternatives(phrase string, dir Direction, k int, opts EncodeOptions) ([][]Location, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("invalid number of alternatives: %d", k)
+	}
+	if opts.constrainsLocations() {
+		return nil, errors.New("alternatives do not support location constraints")
+	}
+	if err := opts.checkLengths(); err != nil {
+		return nil, err
+	}
+
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	longest, err := t.longestRuns(strippedPhrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	segments, next := fewestSegments(longest, opts.MinLen, opts.MaxLen)
+	if next[0] == 0 {
+		return nil, t.splitError(strippedPhrase, dir, opts)
+	}
+
+	// Best first search over partial splits. segments is the exact number
+	// of runs needed to finish from any position, so splits complete in
+	// order of their total number of runs.
+	n := len(strippedPhrase)
+	queue := &splitQueue{}
+	heap.Push(queue, &partialSplit{cost: segments[0]})
+
+	alternatives := [][]Location{}
+	for queue.Len() > 0 && len(alternatives) < k {
+		p := heap.Pop(queue).(*partialSplit)
+		if p.pos == n {
+			locs, err := t.locateSplit(strippedPhrase, dir, p.lengths)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, locs)
+			continue
+		}
+
+		// Push shorter runs first, so longer runs are popped first.
+		lengths := segmentLengths(longest[p.pos], opts.MinLen, opts.MaxLen)
+		for i := len(lengths) - 1; i >= 0; i-- {
+			l := lengths[i]
+			if p.pos+l < n && next[p.pos+l] == 0 {
+				continue
+			}
+			split := append(p.lengths[:len(p.lengths):len(p.lengths)], l)
+			heap.Push(queue, &partialSplit{
+				pos:     p.pos + l,
+				lengths: split,
+				cost:    len(split) + segments[p.pos+l],
+				order:   queue.pushed,
+			})
+		}
+	}
+	return alternatives, nil
+}
+
+// locateSplit chooses a location for each run of a split.
+func (t *Trie) locateSplit(phrase []rune, dir Direction, lengths []int) ([]Location, error) {
+	chosen := [][5]int{}
+	pos := 0
+	for _, l := range lengths {
+		run := phrase[pos : pos+l]
+		_, locations, err := t.searchDir(run, dir)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := t.pickLocation(locations, string(run), chosen)
+		if err != nil {
+			return nil, err
+		}
+		chosen = append(chosen, loc)
+		pos += l
+	}
+	return LocationsFromRaw(chosen), nil
+}
+
+// partialSplit is the start of a split of a phrase into runs.
+type partialSplit struct {
+	pos     int
+	lengths []int
+	// cost is the fewest runs of any split starting this way.
+	cost int
+	// order breaks ties by popping the latest push first, finishing one
+	// split before starting others of the same cost.
+	order int
+}
+
+type splitQueue struct {
+	items  []*partialSplit
+	pushed int
+}
+
+func (q *splitQueue) Len() int { return len(q.items) }
+
+func (q *splitQueue) Less(i, j int) bool {
+	if q.items[i].cost != q.items[j].cost {
+		return q.items[i].cost < q.items[j].cost
+	}
+	return q.items[i].order > q.items[j].order
+}
+
+func (q *splitQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *splitQueue) Push(x any) {
+	q.items = append(q.items, x.(*partialSplit))
+	q.pushed++
+}
+
+func (q *splitQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
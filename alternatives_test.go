@@ -0,0 +1,111 @@
+package whcypher
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrie_EncodeAlternatives(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcd")
+
+	result, err := trie.EncodeAlternatives("abcd", DirectionRight, 4, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := [][]Location{
+		{{Page: 0, Row: 0, Col: 0, Len: 4, Dir: DirectionRight}},
+		{{Page: 0, Row: 0, Col: 0, Len: 3, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 3, Len: 1, Dir: DirectionRight}},
+		{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 2, Dir: DirectionRight}},
+		{{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 1, Len: 3, Dir: DirectionRight}},
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestTrie_EncodeAlternatives_All(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcd")
+
+	// A phrase of n letters has 2^(n-1) splits.
+	result, err := trie.EncodeAlternatives("abcd", DirectionRight, 100, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result) != 8 {
+		t.Errorf("Expected 8 alternatives, got %d", len(result))
+	}
+	for i := 1; i < len(result); i++ {
+		if len(result[i]) < len(result[i-1]) {
+			t.Errorf("Expected alternatives ordered by runs, got %d after %d", len(result[i]), len(result[i-1]))
+		}
+	}
+
+	result, err = trie.EncodeAlternatives("abcd", DirectionRight, 100, EncodeOptions{MinLen: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Expected 2 alternatives with runs of at least 2, got %d", len(result))
+	}
+}
+
+func TestTrie_EncodeAlternatives_Long(t *testing.T) {
+	source := testSource(t)
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	phrase := strings.Repeat("a slow rain on the sand ", 10)
+	result, err := trie.EncodeAlternatives(phrase, DirectionAll, 5, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	optimal, err := trie.EncodeOptimal(phrase, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result) != 5 || len(result[0]) != len(optimal) {
+		t.Fatalf("Expected 5 alternatives starting with %d runs, got %d", len(optimal), len(result))
+	}
+	for _, locs := range result {
+		decoded, err := DecodeLocations(source, locs)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if decoded != strings.ReplaceAll(phrase, " ", "") {
+			t.Errorf("Expected alternative to decode to the phrase, got %q", decoded)
+		}
+	}
+}
+
+func TestTrie_EncodeAlternatives_Invalid(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcd")
+
+	if _, err := trie.EncodeAlternatives("abcd", DirectionRight, 0, EncodeOptions{}); err == nil {
+		t.Error("Expected invalid number of alternatives error, got nil")
+	}
+	if _, err := trie.EncodeAlternatives("abcd", DirectionRight, 2, EncodeOptions{NoReuse: true}); err == nil {
+		t.Error("Expected unsupported constraints error, got nil")
+	}
+	if _, err := trie.EncodeAlternatives("abcd", DirectionRight, 2, EncodeOptions{Ledger: NewLedger()}); err != nil {
+		t.Errorf("Expected an empty ledger to be allowed, got %v", err)
+	}
+	ledger := NewLedger()
+	ledger.Record([]Location{{Page: 0, Row: 0, Col: 0, Len: 4, Dir: DirectionRight}}, time.Now())
+	if _, err := trie.EncodeAlternatives("abcd", DirectionRight, 2, EncodeOptions{Ledger: ledger}); err == nil {
+		t.Error("Expected unsupported constraints error, got nil")
+	}
+	if _, err := trie.EncodeAlternatives("abcd", DirectionRight, 2, EncodeOptions{MaxLen: -1}); err == nil {
+		t.Error("Expected invalid run lengths error, got nil")
+	}
+	if _, err := trie.EncodeAlternatives("abce", DirectionRight, 2, EncodeOptions{}); err == nil {
+		t.Error("Expected letter not found error, got nil")
+	}
+}
@@ -0,0 +1,71 @@
+package whcypher
+
+// BalancedSelector is a LocationSelector that prefers locations whose page,
+// row and column numbers have been used least, so the numbers in codes look
+// evenly spread over many messages. Codes must be passed to Record once
+// sent, and locations chosen earlier in the same phrase count as used.
+type BalancedSelector struct {
+	pages map[int]int
+	rows  map[int]int
+	cols  map[int]int
+}
+
+// NewBalancedSelector returns a selector with no recorded usage.
+func NewBalancedSelector() *BalancedSelector {
+	return &BalancedSelector{
+		pages: make(map[int]int),
+		rows:  make(map[int]int),
+		cols:  make(map[int]int),
+	}
+}
+
+// Record counts the page, row and column of every location as used.
+func (b *BalancedSelector) Record(locs []Location) {
+	for _, l := range locs {
+		b.add(l, 1)
+	}
+}
+
+// RecordLedger counts every use in the ledger.
+func (b *BalancedSelector) RecordLedger(ledger *Ledger) {
+	for _, e := range ledger.Entries() {
+		b.add(e.Location, e.Count)
+	}
+}
+
+func (b *BalancedSelector) add(l Location, n int) {
+	b.pages[l.Page] += n
+	b.rows[l.Row] += n
+	b.cols[l.Col] += n
+}
+
+// Usage returns how often the page, row and column of the location have
+// been used.
+func (b *BalancedSelector) Usage(l Location) (page, row, col int) {
+	return b.pages[l.Page], b.rows[l.Row], b.cols[l.Col]
+}
+
+// SelectLocation picks the candidate whose page, row and column have been
+// used least in total, preferring the earliest candidate on ties.
+func (b *BalancedSelector) SelectLocation(candidates []Location, run string, chosen []Location) int {
+	best, bestScore := 0, -1
+	for i, c := range candidates {
+		page, row, col := b.Usage(c)
+		score := page + row + col
+		for _, l := range chosen {
+			if l.Page == c.Page {
+				score++
+			}
+			if l.Row == c.Row {
+				score++
+			}
+			if l.Col == c.Col {
+				score++
+			}
+		}
+		if bestScore < 0 || score < bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
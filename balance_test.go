@@ -0,0 +1,69 @@
+package whcypher
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBalancedSelector_SelectLocation(t *testing.T) {
+	candidates := []Location{
+		{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight},
+		{Page: 0, Row: 1, Col: 1, Len: 1, Dir: DirectionRight},
+		{Page: 1, Row: 2, Col: 2, Len: 1, Dir: DirectionRight},
+	}
+
+	b := NewBalancedSelector()
+	if i := b.SelectLocation(candidates, "a", nil); i != 0 {
+		t.Errorf("Expected first candidate without usage, got %d", i)
+	}
+
+	b.Record(candidates[:1])
+	if i := b.SelectLocation(candidates, "a", nil); i != 2 {
+		t.Errorf("Expected candidate on an unused page, got %d", i)
+	}
+
+	// Locations chosen earlier in the phrase count as used.
+	if i := b.SelectLocation(candidates, "a", candidates[2:]); i != 1 {
+		t.Errorf("Expected least used candidate 1, got %d", i)
+	}
+
+	ledger := NewLedger()
+	ledger.Record([]Location{candidates[1], candidates[2], candidates[2]}, time.Now())
+	b.RecordLedger(ledger)
+	if page, row, col := b.Usage(candidates[2]); page != 2 || row != 2 || col != 2 {
+		t.Errorf("Expected usage 2 2 2, got %d %d %d", page, row, col)
+	}
+}
+
+func TestBalancedSelector_FlattensRows(t *testing.T) {
+	source, err := ParseSource(strings.NewReader("abc\nabc\nabc\n\nabc\nabc\nabc\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie, err := NewTrieFromSource(source, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	b := NewBalancedSelector()
+	trie.SetLocationSelector(b)
+	for i := 0; i < 12; i++ {
+		locs, err := trie.EncodeLTR("abc", DirectionRight)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		b.Record(locs)
+	}
+
+	for row := 0; row < 3; row++ {
+		if _, n, _ := b.Usage(Location{Row: row}); n != 4 {
+			t.Errorf("Expected row %d to be used 4 times, got %d", row, n)
+		}
+	}
+	for page := 0; page < 2; page++ {
+		if n, _, _ := b.Usage(Location{Page: page}); n != 6 {
+			t.Errorf("Expected page %d to be used 6 times, got %d", page, n)
+		}
+	}
+}
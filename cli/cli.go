@@ -1,88 +1,561 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/regexb/whcypher"
 	"github.com/urfave/cli/v2"
 )
 
-func loadSource(file string) ([][][]byte, error) {
-	data, err := os.ReadFile(file)
+func loadSource(file string) (whcypher.Source, error) {
+	if file == "" {
+		return nil, errors.New("missing source --file")
+	}
+
+	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	var out [][][]byte
-	groups := bytes.Split(data, []byte("\n\n"))
-	for _, g := range groups {
-		out = append(out, bytes.Split(g, []byte("\n")))
-	}
-	return out, nil
-}
-
-func cypherTreeFromSource(source [][][]byte) (*whcypher.Trie, error) {
-	trie := whcypher.NewTrie()
-	for pi, page := range source {
-		for ri, row := range page {
-			for bi := range row {
-				// traverse right
-				if err := trie.InsertPagePart(whcypher.DirectionRight, pi, ri, bi, string(rowFromSource(page, ri, bi, 0, 1))); err != nil {
-					return nil, err
-				}
-
-				// traverse left
-				if err := trie.InsertPagePart(whcypher.DirectionLeft, pi, ri, bi, string(rowFromSource(page, ri, bi, 0, -1))); err != nil {
-					return nil, err
-				}
-
-				// traverse up
-				if err := trie.InsertPagePart(whcypher.DirectionUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, 0))); err != nil {
-					return nil, err
-				}
-
-				// traverse down
-				if err := trie.InsertPagePart(whcypher.DirectionDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, 0))); err != nil {
-					return nil, err
-				}
-
-				// traverse diagonally
-				if err := trie.InsertPagePart(whcypher.DirectionRightDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, 1))); err != nil {
-					return nil, err
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionLeftDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, -1))); err != nil {
-					return nil, err
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionRightUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, 1))); err != nil {
-					return nil, err
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionLeftUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, -1))); err != nil {
-					return nil, err
-				}
-			}
+	return whcypher.ParseSource(f)
+}
+
+// alphabetFromFlags returns the --alphabet letters, which may also name a
+// preset or "source" for every letter found in the source.
+func alphabetFromFlags(ctx *cli.Context, source whcypher.Source) (*whcypher.Alphabet, error) {
+	switch letters := ctx.String("alphabet"); letters {
+	case "", "latin":
+		return whcypher.AlphabetLatin, nil
+	case "digits":
+		return whcypher.AlphabetLatinDigits, nil
+	case "german":
+		return whcypher.AlphabetGerman, nil
+	case "spanish":
+		return whcypher.AlphabetSpanish, nil
+	case "source":
+		return whcypher.AlphabetOf(source)
+	default:
+		return whcypher.NewAlphabet(letters)
+	}
+}
+
+// buildTrie indexes the source for the directions in dir using the
+// --alphabet letters, in a suffix index with --compact, using --workers
+// goroutines. With --wrap the runs wrap around the page edges.
+func buildTrie(ctx *cli.Context, source whcypher.Source, dir whcypher.Direction) (*whcypher.Trie, error) {
+	alphabet, err := alphabetFromFlags(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Bool("compact") {
+		newIndex := whcypher.NewSuffixIndex
+		if ctx.Bool("wrap") {
+			newIndex = whcypher.NewWrappedSuffixIndex
 		}
+		index, err := newIndex(source, dir, alphabet)
+		if err != nil {
+			return nil, err
+		}
+		return whcypher.NewTrieWithIndex(index), nil
 	}
 
+	trie := whcypher.NewTrieWithAlphabet(alphabet)
+	if err := trie.SetWrap(ctx.Bool("wrap")); err != nil {
+		return nil, err
+	}
+	if err := trie.InsertSourceParallel(source, dir, ctx.Int("workers")); err != nil {
+		return nil, err
+	}
 	return trie, nil
 }
 
-// rowFromSource returns the string of characters walking in the x and y direction
-func rowFromSource(source [][]byte, startX, startY, moveX, moveY int) []byte {
-	row := make([]byte, 0)
-	x, y := startX, startY
+// loadTrie returns a trie searching the directions in dir, read from --index
+// or built for just those directions from the --file source, and the source
+// when one was read. A saved index is checked against --file, or else the
+// source it was built from.
+func loadTrie(ctx *cli.Context, dir whcypher.Direction) (*whcypher.Trie, whcypher.Source, error) {
+	indexFile := ctx.Path("index")
+	if indexFile == "" {
+		sourceFile := ctx.Path("file")
+		start := time.Now()
+		source, err := loadSource(sourceFile)
+		if err != nil {
+			slog.Error("Failed to load source", "file", sourceFile)
+			return nil, nil, err
+		}
+		slog.Info("Finished loading source", "pages", len(source), "time", time.Since(start))
+
+		slog.Info("Loading source into trie")
+		start = time.Now()
+		trie, err := buildTrie(ctx, source, dir)
+		if err != nil {
+			slog.Error("Failed to load source into cypher trie", "time", time.Since(start))
+			return nil, nil, err
+		}
+		slog.Info("Finished loading source into cypher trie", "time", time.Since(start))
+		return trie, source, nil
+	}
+
+	start := time.Now()
+	f, err := os.Open(indexFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	// Nearly everything read is kept, so collecting garbage while reading
+	// only slows the load down without freeing memory.
+	gcPercent := debug.SetGCPercent(-1)
+	trie, header, err := whcypher.ReadIndex(f)
+	debug.SetGCPercent(gcPercent)
+	if err != nil {
+		slog.Error("Failed to load index", "file", indexFile)
+		return nil, nil, err
+	}
+	slog.Info("Finished loading index", "directions", header.Directions, "time", time.Since(start))
+
+	// Without --file the index is checked against the source it was built
+	// from, when that is still there. A relative source name, such as one
+	// given with --source_name, is found next to the index.
+	var source whcypher.Source
+	sourceFile := ctx.Path("file")
+	if sourceFile == "" && header.SourceName != "" {
+		name := header.SourceName
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(indexFile), name)
+		}
+		if _, err := os.Stat(name); err == nil {
+			sourceFile = name
+		}
+	}
+	if sourceFile != "" {
+		source, err = loadSource(sourceFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := header.Check(source); err != nil {
+			return nil, nil, fmt.Errorf("%s checked against %s: %w, rebuild it with whcli index build", indexFile, sourceFile, err)
+		}
+	} else {
+		slog.Warn("Skipped checking index against its source, which was not found next to it, pass --file to check it", "source", header.SourceName)
+	}
+	if err := trie.CheckDirections(dir); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w, rebuild it with whcli index build", indexFile, err)
+	}
+	if header.Wrap != ctx.Bool("wrap") {
+		if header.Wrap {
+			return nil, nil, fmt.Errorf("%s holds runs that wrap around the page edges, use it with --wrap", indexFile)
+		}
+		return nil, nil, fmt.Errorf("%s does not wrap around the page edges, rebuild it with --wrap", indexFile)
+	}
+	return trie, source, nil
+}
+
+// explainUnencodable prints the report of a phrase that can not be encoded,
+// filled in with every direction that has its missing letters by searching
+// the source in the directions the trie does not hold. Only the built
+// directions are reported when the source was not read.
+func explainUnencodable(ctx *cli.Context, cypher *whcypher.Trie, source whcypher.Source, in string, dir whcypher.Direction, err error) error {
+	var unencodable *whcypher.UnencodableError
+	if !errors.As(err, &unencodable) {
+		return err
+	}
+
+	if source != nil {
+		start := time.Now()
+		report, diagnoseErr := cypher.DiagnoseSource(source, in, dir)
+		if diagnoseErr != nil {
+			slog.Error("Failed to search source for missing letters", "error", diagnoseErr)
+		} else {
+			slog.Info("Finished searching source for missing letters", "time", time.Since(start))
+			if report != nil {
+				*unencodable = *report
+			}
+		}
+	}
+	fmt.Fprint(ctx.App.ErrWriter, unencodable.Report(ctx.Int("page_offset")))
+	return err
+}
+
+// directionFromFlags returns the direction mask enabled by the direction flags.
+func directionFromFlags(ctx *cli.Context) whcypher.Direction {
+	if ctx.Bool("allDirection") {
+		return whcypher.DirectionAll
+	}
+
+	dir := whcypher.Direction(0)
+	if ctx.Bool("right") {
+		dir |= whcypher.DirectionRight
+	}
+	if ctx.Bool("left") {
+		dir |= whcypher.DirectionLeft
+	}
+	if ctx.Bool("up") {
+		dir |= whcypher.DirectionUp
+	}
+	if ctx.Bool("down") {
+		dir |= whcypher.DirectionDown
+	}
+	return dir
+}
+
+func printDecoded(ctx *cli.Context, source whcypher.Source, code []whcypher.Location) error {
+	out, err := whcypher.DecodeLocations(source, code)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.App.Writer, "Decoded text:")
+	fmt.Fprintln(ctx.App.Writer, out)
+	return nil
+}
+
+func decodeAction(ctx *cli.Context) error {
+	sourceFile := ctx.Path("file")
+	source, err := loadSource(sourceFile)
+	if err != nil {
+		slog.Error("Failed to load source", "file", sourceFile)
+		return err
+	}
+
+	in := ctx.String("code")
+	if in == "" {
+		in = strings.Join(ctx.Args().Slice(), " ")
+	}
+	code, err := whcypher.ParseCode(in)
+	if err != nil {
+		return err
+	}
+	for i := range code {
+		code[i] = code[i].Offset(-ctx.Int("page_offset"), -ctx.Int("row_offset"), -ctx.Int("col_offset"))
+	}
+
+	// Versioned codes carry the direction of every segment.
+	if code[0].Dir != 0 {
+		return printDecoded(ctx, source, code)
+	}
+
+	dir := directionFromFlags(ctx)
+	if ctx.IsSet("dir") {
+		dir, err = whcypher.ParseDirection(ctx.String("dir"))
+		if err != nil {
+			return err
+		}
+	}
+	dirs := dir.Directions()
+	if len(dirs) == 0 {
+		return errors.New("no direction enabled")
+	}
+
+	// Without a version the code can not mark wrapped segments, so every
+	// segment wraps with --wrap. Those that stay on the page read the same.
+	for i := range code {
+		code[i].Wrap = ctx.Bool("wrap")
+	}
+
+	// A single direction decodes the whole code.
+	if len(dirs) == 1 {
+		for i := range code {
+			code[i].Dir = dirs[0]
+		}
+		return printDecoded(ctx, source, code)
+	}
+
+	// Otherwise print every reading of each segment that stays on the page.
+	fmt.Fprintln(ctx.App.Writer, "Decoded candidates:")
+	for i, part := range code {
+		fmt.Fprintf(ctx.App.Writer, "%d:", i+1)
+		found := false
+		for _, d := range dirs {
+			part.Dir = d
+			letters, err := whcypher.DecodeLocation(source, part.Raw())
+			if err != nil {
+				continue
+			}
+			found = true
+			fmt.Fprintf(ctx.App.Writer, " %s=%s", d, letters)
+		}
+		if !found {
+			fmt.Fprint(ctx.App.Writer, " (none)")
+		}
+		fmt.Fprintln(ctx.App.Writer)
+	}
+	return nil
+}
+
+func entropyAction(ctx *cli.Context) error {
+	if ctx.Int("weakest") < 0 {
+		return errors.New("--weakest can not be negative")
+	}
+	dir := directionFromFlags(ctx)
+	cypher, source, err := loadTrie(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	in := ctx.String("input")
+	if in == "" {
+		in = strings.Join(ctx.Args().Slice(), " ")
+	}
+	report, err := cypher.Entropy(in, dir)
+	if err != nil {
+		return explainUnencodable(ctx, cypher, source, in, dir, err)
+	}
+
+	if report.Exact {
+		fmt.Fprintf(ctx.App.Writer, "Encodings: %s\n", report.Encodings)
+		fmt.Fprintf(ctx.App.Writer, "Entropy: %.2f bits\n", report.Bits)
+	} else {
+		fmt.Fprintf(ctx.App.Writer, "Entropy: about %.2f bits (estimated)\n", report.Bits)
+	}
+	fmt.Fprintln(ctx.App.Writer, "Weakest letters:")
+	for _, p := range report.Weakest(ctx.Int("weakest")) {
+		fmt.Fprintf(ctx.App.Writer, "%d\t%c\t%d choices\t%.2f bits\n", p.Index+1, p.Letter, p.Choices, p.Bits)
+	}
+	return nil
+}
+
+// formatCode writes the locations with the display offsets applied.
+func formatCode(ctx *cli.Context, dir whcypher.Direction, locs []whcypher.Location) (string, error) {
+	// Codes read only right keep the original format without directions,
+	// which can not mark wrapped segments.
+	format := whcypher.CodeFormatV1
+	if dir == whcypher.DirectionRight && !ctx.Bool("wrap") {
+		format = whcypher.CodeFormatLegacy
+	}
+
+	out := make([]whcypher.Location, len(locs))
+	for i, l := range locs {
+		out[i] = l.Offset(ctx.Int("page_offset"), ctx.Int("row_offset"), ctx.Int("col_offset"))
+	}
+	return whcypher.FormatCode(out, format)
+}
+
+func encodeAction(ctx *cli.Context) error {
+	slog.Info("Starting...")
+
+	// Reject flags that can never work together before the slow index
+	// build. Alternatives pick locations without the ledger and are not
+	// recorded.
+	if ctx.Int("alternatives") > 0 && ctx.Path("ledger") != "" {
+		return errors.New("--alternatives can not be used with --ledger")
+	}
+	switch {
+	case ctx.Bool("secure") && ctx.IsSet("seed"):
+		return errors.New("--secure and --seed can not be used together")
+	case ctx.Bool("balance") && (ctx.Bool("secure") || ctx.IsSet("seed")):
+		return errors.New("--balance can not be used with --secure or --seed")
+	case ctx.Bool("balance") && ctx.Path("ledger") == "":
+		return errors.New("--balance needs a --ledger of earlier codes")
+	case ctx.Bool("avoid_ledger") && ctx.Path("ledger") == "":
+		return errors.New("--avoid_ledger needs a --ledger of earlier codes")
+	}
+
+	dir := directionFromFlags(ctx)
+	cypher, source, err := loadTrie(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ctx.Bool("secure"):
+		cypher.WithSecureLocSelect()
+	case ctx.IsSet("seed"):
+		cypher.WithSeededLocSelect(ctx.Int64("seed"))
+	}
+
+	in := ctx.String("input")
+	if in == "" {
+		in = strings.Join(ctx.Args().Slice(), " ")
+	}
+	start := time.Now()
+	opts := whcypher.EncodeOptions{
+		Strategy:  whcypher.StrategyLongest,
+		NoReuse:   ctx.Bool("no_reuse"),
+		NoOverlap: ctx.Bool("no_overlap"),
+		MinLen:    ctx.Int("min_len"),
+		MaxLen:    ctx.Int("max_len"),
+	}
+	switch {
+	case ctx.Bool("optimal"):
+		opts.Strategy = whcypher.StrategyOptimal
+	case ctx.Bool("ltr"):
+		opts.Strategy = whcypher.StrategyLTR
+	}
+	ledgerFile := ctx.Path("ledger")
+	if ledgerFile != "" {
+		opts.Ledger, err = whcypher.LoadLedger(ledgerFile)
+		if err != nil {
+			slog.Error("Failed to load ledger", "file", ledgerFile)
+			return err
+		}
+		opts.AvoidLedger = ctx.Bool("avoid_ledger")
+
+		if ctx.Bool("balance") {
+			balanced := whcypher.NewBalancedSelector()
+			balanced.RecordLedger(opts.Ledger)
+			cypher.SetLocationSelector(balanced)
+		}
+	}
+
+	if k := ctx.Int("alternatives"); k > 0 {
+		alternatives, err := cypher.EncodeAlternatives(in, dir, k, opts)
+		if err != nil {
+			slog.Info("Failed to generate cypher alternatives", "phrase", in, "time", time.Since(start))
+			return explainUnencodable(ctx, cypher, source, in, dir, err)
+		}
+		slog.Info("Finished generating cypher alternatives", "count", len(alternatives), slog.Duration("time", time.Since(start)))
+
+		fmt.Fprintln(ctx.App.Writer, "Generated cypher alternatives:")
+		for i, out := range alternatives {
+			code, err := formatCode(ctx, dir, out)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(ctx.App.Writer, "%d (%d segments): %s\n", i+1, len(out), code)
+		}
+		return nil
+	}
+
+	out, err := cypher.Encode(in, dir, opts)
+	if err != nil {
+		slog.Info("Failed to generate cypher", "phrase", in, "time", time.Since(start))
+		return explainUnencodable(ctx, cypher, source, in, dir, err)
+	}
+	slog.Info("Finished generating cypher", slog.Any("raw", out), slog.Duration("time", time.Since(start)))
+
+	if ledgerFile != "" {
+		err := whcypher.UpdateLedger(ledgerFile, func(l *whcypher.Ledger) error {
+			l.Record(out, time.Now())
+			return nil
+		})
+		if err != nil {
+			slog.Error("Failed to record cypher in ledger", "file", ledgerFile)
+			return err
+		}
+	}
+
+	code, err := formatCode(ctx, dir, out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.App.Writer, "Generated cypher:")
+	fmt.Fprintln(ctx.App.Writer, code)
+
+	return nil
+}
+
+func ledgerPath(ctx *cli.Context) (string, error) {
+	path := ctx.Path("ledger")
+	if path == "" {
+		return "", errors.New("missing --ledger")
+	}
+	return path, nil
+}
+
+func ledgerShowAction(ctx *cli.Context) error {
+	path, err := ledgerPath(ctx)
+	if err != nil {
+		return err
+	}
+	ledger, err := whcypher.LoadLedger(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "%d locations used\n", ledger.Len())
+	for _, e := range ledger.Entries() {
+		loc := e.Location.Offset(ctx.Int("page_offset"), ctx.Int("row_offset"), ctx.Int("col_offset"))
+		fmt.Fprintf(ctx.App.Writer, "%d\t%s\t%s\n", e.Count, e.LastUsed.Format(time.RFC3339), loc)
+	}
+	return nil
+}
+
+func indexBuildAction(ctx *cli.Context) error {
+	out := ctx.Path("out")
+	sourceFile := ctx.Path("file")
+	source, err := loadSource(sourceFile)
+	if err != nil {
+		slog.Error("Failed to load source", "file", sourceFile)
+		return err
+	}
+
+	dir := directionFromFlags(ctx)
+	start := time.Now()
+	trie, err := buildTrie(ctx, source, dir)
+	if err != nil {
+		return err
+	}
+	slog.Info("Finished loading source into cypher trie", "directions", dir, "time", time.Since(start))
+
+	// Save the absolute path so the index finds its source to be checked
+	// against from any directory, unless the index is shared with others
+	// who should not see it.
+	sourceName := ctx.String("source_name")
+	if sourceName == "" {
+		sourceName, err = filepath.Abs(sourceFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write to a temporary file first so a failed build never replaces a
+	// working index.
+	f, err := os.CreateTemp(filepath.Dir(out), filepath.Base(out)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := trie.WriteIndex(f, source, sourceName); err != nil {
+		f.Close()
+		return err
+	}
+	// CreateTemp leaves the file readable only by its owner.
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), out); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.App.Writer, "Wrote index for %s to %s\n", dir, out)
+	return nil
+}
 
-	for x >= 0 && x < len(source) && y >= 0 && y < len(source[x]) {
-		row = append(row, source[x][y])
-		x += moveX
-		y += moveY
+func ledgerResetAction(ctx *cli.Context) error {
+	path, err := ledgerPath(ctx)
+	if err != nil {
+		return err
 	}
+	return whcypher.UpdateLedger(path, func(l *whcypher.Ledger) error {
+		fmt.Fprintf(ctx.App.Writer, "Removed %d locations\n", l.Len())
+		l.Reset()
+		return nil
+	})
+}
 
-	return row
+func ledgerPruneAction(ctx *cli.Context) error {
+	path, err := ledgerPath(ctx)
+	if err != nil {
+		return err
+	}
+	before := time.Now().Add(-ctx.Duration("older_than"))
+	return whcypher.UpdateLedger(path, func(l *whcypher.Ledger) error {
+		fmt.Fprintf(ctx.App.Writer, "Removed %d locations\n", l.Prune(before))
+		return nil
+	})
 }
 
 func main() {
@@ -90,83 +563,103 @@ func main() {
 		Name:                   "whcli",
 		UseShortOptionHandling: true,
 		Flags: []cli.Flag{
-			&cli.PathFlag{Name: "file", Aliases: []string{"f"}, Required: true},
+			&cli.PathFlag{Name: "file", Aliases: []string{"f"}},
+			&cli.PathFlag{Name: "index", Usage: "index saved by whcli index build, used instead of building one from --file"},
 			&cli.StringFlag{Name: "input", Aliases: []string{"in", "i"}},
+			&cli.StringFlag{Name: "alphabet", Usage: "letters the source and input may use: latin, digits, german, spanish, source (every letter in the source) or the letters themselves (default latin)"},
 			&cli.IntFlag{Name: "page_offset", Aliases: []string{"po"}, Value: 1},
 			&cli.IntFlag{Name: "row_offset", Aliases: []string{"ro"}, Value: 1},
 			&cli.IntFlag{Name: "col_offset", Aliases: []string{"co"}, Value: 1},
 			&cli.BoolFlag{Name: "ltr", Value: false},
+			&cli.BoolFlag{Name: "optimal", Usage: "use the fewest segments possible", Value: false},
+			&cli.BoolFlag{Name: "no_reuse", Usage: "never use the same location twice", Value: false},
+			&cli.BoolFlag{Name: "no_overlap", Usage: "never use the same cell twice", Value: false},
+			&cli.IntFlag{Name: "min_len", Usage: "fewest letters in each segment"},
+			&cli.IntFlag{Name: "max_len", Usage: "most letters in each segment, 0 for no limit"},
+			&cli.Int64Flag{Name: "seed", Usage: "pick among locations at random, giving the same code for the same seed"},
+			&cli.BoolFlag{Name: "secure", Usage: "pick among locations using crypto/rand", Value: false},
+			&cli.BoolFlag{Name: "compact", Usage: "index the source with suffix arrays, using far less memory on large sources", Value: false},
+			&cli.IntFlag{Name: "workers", Usage: "goroutines building the trie, 0 for one per CPU"},
+			&cli.BoolFlag{Name: "wrap", Usage: "let segments run off one edge of the page onto the opposite one", Value: false},
+			&cli.PathFlag{Name: "ledger", Usage: "file recording every location used, which later codes try last"},
+			&cli.BoolFlag{Name: "balance", Usage: "prefer the pages, rows and columns used least in the ledger", Value: false},
+			&cli.BoolFlag{Name: "avoid_ledger", Usage: "never use a location recorded in the ledger", Value: false},
 			&cli.BoolFlag{Name: "right", Aliases: []string{"r"}, Value: true},
 			&cli.BoolFlag{Name: "left", Aliases: []string{"l"}, Value: false},
 			&cli.BoolFlag{Name: "up", Aliases: []string{"u"}, Value: false},
 			&cli.BoolFlag{Name: "down", Aliases: []string{"d"}, Value: false},
 			&cli.BoolFlag{Name: "allDirection", Aliases: []string{"all"}, Value: false},
 		},
-		Action: func(ctx *cli.Context) error {
-			slog.Info("Starting...")
-
-			sourceFile := ctx.Path("file")
-			start := time.Now()
-			source, err := loadSource(sourceFile)
-			if err != nil {
-				slog.Error("Failed to load source", "file", sourceFile)
-				return err
-			}
-			slog.Info("Finished loading source", "pages", len(source), "time", time.Since(start))
-
-			slog.Info("Loading source into trie")
-			start = time.Now()
-			cypher, err := cypherTreeFromSource(source)
-			if err != nil {
-				slog.Error("Failed to load source into cypher trie", "time", time.Since(start))
-				return err
-			}
-			slog.Info("Finished loading source into cypher trie", "time", time.Since(start))
-
-			dir := whcypher.Direction(0)
-
-			if ctx.Bool("right") {
-				dir |= whcypher.DirectionRight
-			}
-			if ctx.Bool("left") {
-				dir |= whcypher.DirectionLeft
-			}
-			if ctx.Bool("up") {
-				dir |= whcypher.DirectionUp
-			}
-			if ctx.Bool("down") {
-				dir |= whcypher.DirectionDown
-			}
-			if ctx.Bool("allDirection") {
-				dir = whcypher.DirectionDiag | whcypher.DirectionRight | whcypher.DirectionLeft | whcypher.DirectionUp | whcypher.DirectionDown
-			}
-
-			in := ctx.String("input")
-			start = time.Now()
-			var out [][5]int
-			if ctx.Bool("ltr") {
-				out, err = cypher.ConstructPhraseLTR(in, dir)
-			} else {
-				out, err = cypher.ConstructPhraseLongest(in, dir)
-			}
-			if err != nil {
-				slog.Info("Failed to generate cypher", "phrase", in, "time", time.Since(start))
-				return err
-			}
-			slog.Info("Finished generating cypher", slog.Any("raw", out), slog.Duration("time", time.Since(start)))
-
-			fmt.Fprintln(ctx.App.Writer, "Generated cypher:")
-			for i, part := range out {
-				fmt.Fprintf(ctx.App.Writer, "%d %d %d %d", part[0]+ctx.Int("page_offset"), part[1]+ctx.Int("row_offset"), part[2]+ctx.Int("col_offset"), part[3])
-				if i == len(out)-1 {
-					fmt.Fprintln(ctx.App.Writer)
-				} else {
-					fmt.Fprint(ctx.App.Writer, " ")
-				}
-			}
-
-			return nil
+		Commands: []*cli.Command{
+			{
+				Name:      "encode",
+				Usage:     "encode text into a code, the default command",
+				ArgsUsage: "[phrase]",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "alternatives", Usage: "print this many codes splitting the phrase differently, fewest segments first, not recorded in a --ledger"},
+				},
+				Action: encodeAction,
+			},
+			{
+				Name:      "decode",
+				Usage:     "decode a code back into text",
+				ArgsUsage: "[code]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "code", Aliases: []string{"c"}},
+					&cli.StringFlag{Name: "dir", Usage: "direction of every segment, e.g. right or left-down"},
+				},
+				Action: decodeAction,
+			},
+			{
+				Name:      "entropy",
+				Usage:     "count the codes a phrase has and how much randomness picking one gives",
+				ArgsUsage: "[phrase]",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "weakest", Usage: "number of weakest letters to report", Value: 5},
+				},
+				Action: entropyAction,
+			},
+			{
+				Name:  "index",
+				Usage: "manage saved indexes of a source",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "build",
+						Usage: "index the --file source for the enabled directions and save it, as suffix arrays with --compact",
+						Flags: []cli.Flag{
+							&cli.PathFlag{Name: "out", Aliases: []string{"o"}, Usage: "file to save the index to", Required: true},
+							&cli.StringFlag{Name: "source_name", Usage: "name of the source saved in the index, found relative to the index when it is loaded (default the absolute path of --file)"},
+						},
+						Action: indexBuildAction,
+					},
+				},
+			},
+			{
+				Name:  "ledger",
+				Usage: "manage the --ledger of used locations",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "show",
+						Usage:  "print every used location, most used first",
+						Action: ledgerShowAction,
+					},
+					{
+						Name:   "reset",
+						Usage:  "remove every entry",
+						Action: ledgerResetAction,
+					},
+					{
+						Name:  "prune",
+						Usage: "remove entries not used recently",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{Name: "older_than", Usage: "remove entries last used longer ago than this", Required: true},
+						},
+						Action: ledgerPruneAction,
+					},
+				},
+			},
 		},
+		Action: encodeAction,
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -0,0 +1,131 @@
+package whcypher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CodeFormat is a textual format for a list of locations.
+type CodeFormat int
+
+const (
+	// CodeFormatLegacy is "page row col len" per segment with no direction,
+	// which can only describe codes read right.
+	CodeFormatLegacy CodeFormat = iota
+	// CodeFormatV1 starts with the "w1" version token and is followed by
+	// "page row col len dir" per segment, where dir is a short direction
+	// token such as "r" or "ld", ending in "~" for a segment that wraps
+	// around the page edges.
+	CodeFormatV1
+)
+
+const (
+	codeVersion1 = "w1"
+	codeWrap     = "~"
+)
+
+var directionTokens = map[Direction]string{
+	DirectionRight:     "r",
+	DirectionLeft:      "l",
+	DirectionUp:        "u",
+	DirectionDown:      "d",
+	DirectionRightUp:   "ru",
+	DirectionLeftUp:    "lu",
+	DirectionRightDown: "rd",
+	DirectionLeftDown:  "ld",
+}
+
+// FormatCode writes the locations in the given format.
+func FormatCode(locs []Location, format CodeFormat) (string, error) {
+	parts := []string{}
+	switch format {
+	case CodeFormatLegacy:
+		for _, l := range locs {
+			if l.Dir != 0 && l.Dir != DirectionRight {
+				return "", errors.New("legacy code can not describe direction: " + l.Dir.String())
+			}
+			if l.Wrap {
+				return "", errors.New("legacy code can not describe a wrapped segment")
+			}
+			parts = append(parts, fmt.Sprintf("%d %d %d %d", l.Page, l.Row, l.Col, l.Len))
+		}
+	case CodeFormatV1:
+		parts = append(parts, codeVersion1)
+		for _, l := range locs {
+			token, ok := directionTokens[l.Dir]
+			if !ok {
+				return "", fmt.Errorf("invalid direction: %d", l.Dir)
+			}
+			if l.Wrap {
+				token += codeWrap
+			}
+			parts = append(parts, fmt.Sprintf("%d %d %d %d %s", l.Page, l.Row, l.Col, l.Len, token))
+		}
+	default:
+		return "", fmt.Errorf("unknown code format: %d", format)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// ParseCode reads a code written by FormatCode. Locations in a legacy code
+// have no direction.
+func ParseCode(code string) ([]Location, error) {
+	fields := strings.Fields(strings.ToLower(code))
+	if len(fields) == 0 {
+		return nil, errors.New("invalid code: empty")
+	}
+
+	size := 4
+	if strings.HasPrefix(fields[0], "w") {
+		if fields[0] != codeVersion1 {
+			return nil, errors.New("unsupported code version: " + fields[0])
+		}
+		fields = fields[1:]
+		size = 5
+	}
+	if len(fields) == 0 || len(fields)%size != 0 {
+		return nil, fmt.Errorf("invalid code: expected groups of %d values", size)
+	}
+
+	locs := make([]Location, 0, len(fields)/size)
+	for i := 0; i < len(fields); i += size {
+		group := fields[i : i+size]
+		if size == 5 {
+			token, wrap := strings.CutSuffix(group[4], codeWrap)
+			dir, err := parseDirectionToken(token)
+			if err != nil {
+				return nil, err
+			}
+			group = append(group[:4:4], dir.String())
+			if wrap {
+				group = append(group, locationWrap)
+			}
+		}
+
+		var l Location
+		if err := l.UnmarshalText([]byte(strings.Join(group, " "))); err != nil {
+			return nil, err
+		}
+		locs = append(locs, l)
+	}
+	return locs, nil
+}
+
+// parseDirectionToken reads a single short direction token, or a full
+// direction name.
+func parseDirectionToken(token string) (Direction, error) {
+	for dir, t := range directionTokens {
+		if t == token {
+			return dir, nil
+		}
+	}
+	dir, err := ParseDirection(token)
+	if err != nil {
+		return 0, err
+	}
+	if _, _, ok := dir.Delta(); !ok {
+		return 0, errors.New("invalid direction: " + token)
+	}
+	return dir, nil
+}
@@ -0,0 +1,158 @@
+package whcypher
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatCode(t *testing.T) {
+	locs := []Location{
+		{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRight},
+		{Page: 5, Row: 6, Col: 7, Len: 2, Dir: DirectionLeftDown},
+	}
+
+	testCases := []struct {
+		description string
+		locs        []Location
+		format      CodeFormat
+		expected    string
+		expectErr   bool
+	}{
+		{
+			description: "Legacy",
+			locs:        locs[:1],
+			format:      CodeFormatLegacy,
+			expected:    "3 2 1 4",
+		},
+		{
+			description: "Legacy with direction",
+			locs:        locs,
+			format:      CodeFormatLegacy,
+			expectErr:   true,
+		},
+		{
+			description: "V1",
+			locs:        locs,
+			format:      CodeFormatV1,
+			expected:    "w1 3 2 1 4 r 5 6 7 2 ld",
+		},
+		{
+			description: "V1 wrapped",
+			locs:        []Location{{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRight, Wrap: true}},
+			format:      CodeFormatV1,
+			expected:    "w1 3 2 1 4 r~",
+		},
+		{
+			description: "Legacy wrapped",
+			locs:        []Location{{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRight, Wrap: true}},
+			format:      CodeFormatLegacy,
+			expectErr:   true,
+		},
+		{
+			description: "V1 without direction",
+			locs:        []Location{{Page: 1, Row: 1, Col: 1, Len: 1}},
+			format:      CodeFormatV1,
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := FormatCode(tc.locs, tc.format)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	testCases := []struct {
+		description string
+		code        string
+		expected    []Location
+		expectErr   bool
+	}{
+		{
+			description: "Legacy",
+			code:        "3 2 1 4 5 6 7 2",
+			expected:    []Location{{Page: 3, Row: 2, Col: 1, Len: 4}, {Page: 5, Row: 6, Col: 7, Len: 2}},
+		},
+		{
+			description: "V1",
+			code:        "w1 3 2 1 4 r 5 6 7 2 ld",
+			expected: []Location{
+				{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRight},
+				{Page: 5, Row: 6, Col: 7, Len: 2, Dir: DirectionLeftDown},
+			},
+		},
+		{
+			description: "V1 with direction names",
+			code:        "W1 3 2 1 4 Right-Up",
+			expected:    []Location{{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRightUp}},
+		},
+		{
+			description: "V1 wrapped",
+			code:        "w1 3 2 1 4 ld~ 5 6 7 2 r",
+			expected: []Location{
+				{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionLeftDown, Wrap: true},
+				{Page: 5, Row: 6, Col: 7, Len: 2, Dir: DirectionRight},
+			},
+		},
+		{description: "Empty", code: "", expectErr: true},
+		{description: "Legacy incomplete", code: "3 2 1", expectErr: true},
+		{description: "V1 incomplete", code: "w1 3 2 1 4", expectErr: true},
+		{description: "V1 combined direction", code: "w1 3 2 1 4 right|left", expectErr: true},
+		{description: "V1 unknown direction", code: "w1 3 2 1 4 x", expectErr: true},
+		{description: "Unknown version", code: "w2 3 2 1 4 r", expectErr: true},
+		{description: "Not a number", code: "3 2 a 4", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := ParseCode(tc.code)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if diff := cmp.Diff(result, tc.expected); diff != "" {
+				t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+			}
+		})
+	}
+}
+
+func TestCode_RoundTrip(t *testing.T) {
+	locs := []Location{
+		{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionUp},
+		{Page: 1, Row: 2, Col: 3, Len: 4, Dir: DirectionLeftUp},
+		{Page: 9, Row: 14, Col: 14, Len: 15, Dir: DirectionDown},
+		{Page: 2, Row: 14, Col: 13, Len: 5, Dir: DirectionRightDown, Wrap: true},
+	}
+	code, err := FormatCode(locs, CodeFormatV1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := ParseCode(code)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(result, locs); diff != "" {
+		t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+	}
+}
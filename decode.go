@@ -0,0 +1,102 @@
+package whcypher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Delta returns the row and column step taken when walking the grid in a
+// single direction. ok is false when d is not exactly one direction.
+func (d Direction) Delta() (rowStep, colStep int, ok bool) {
+	switch d {
+	case DirectionRight:
+		return 0, 1, true
+	case DirectionLeft:
+		return 0, -1, true
+	case DirectionUp:
+		return -1, 0, true
+	case DirectionDown:
+		return 1, 0, true
+	case DirectionRightUp:
+		return -1, 1, true
+	case DirectionLeftUp:
+		return -1, -1, true
+	case DirectionRightDown:
+		return 1, 1, true
+	case DirectionLeftDown:
+		return 1, -1, true
+	}
+	return 0, 0, false
+}
+
+// Decode walks the source for every [page, row, col, len, direction] tuple
+// and returns the recovered plaintext. A direction of 0 is read as
+// DirectionRight, matching codes that were printed without one.
+func Decode(source Source, codes [][5]int) (string, error) {
+	var out strings.Builder
+	for i, code := range codes {
+		part, err := DecodeLocation(source, code)
+		if err != nil {
+			return "", fmt.Errorf("segment %d: %w", i+1, err)
+		}
+		out.WriteString(part)
+	}
+	return out.String(), nil
+}
+
+// DecodeLocation returns the letters covered by a single
+// [page, row, col, len, direction] tuple. A direction with WrapBit set
+// carries on from the opposite edge of the page, see Source.WalkWrap.
+func DecodeLocation(source Source, code [5]int) (string, error) {
+	page, row, col, length := code[0], code[1], code[2], code[3]
+
+	wrap := code[4]&WrapBit != 0
+	dir := Direction(code[4] &^ WrapBit)
+	if dir == 0 {
+		dir = DirectionRight
+	}
+	rowStep, colStep, ok := dir.Delta()
+	if !ok || code[4] < 0 || code[4]&^WrapBit > int(DirectionAll) {
+		return "", fmt.Errorf("invalid direction: %d", code[4])
+	}
+
+	if page < 0 || page >= len(source) {
+		return "", fmt.Errorf("page out of range: %d", page)
+	}
+	grid := source[page]
+	if row < 0 || row >= len(grid) {
+		return "", fmt.Errorf("row out of range: %d", row)
+	}
+	if col < 0 || col >= len(grid[row]) {
+		return "", fmt.Errorf("column out of range: %d", col)
+	}
+	if length < 1 {
+		return "", fmt.Errorf("invalid length: %d", length)
+	}
+
+	if wrap {
+		if _, _, ok := source.PageSize(page); !ok {
+			return "", fmt.Errorf("page %d can not wrap: its rows differ in length", page)
+		}
+		letters := source.WalkWrap(page, row, col, dir)
+		if length > len(letters) {
+			return "", fmt.Errorf("length out of range: %d wraps back to its first letter after %d letters", length, len(letters))
+		}
+		return strings.ToLower(string(letters[:length])), nil
+	}
+
+	// The run can not be longer than the page is wide or tall, so size the
+	// buffer by the page rather than by the untrusted length.
+	letters := make([]rune, 0, min(length, max(len(grid), len(grid[row]))))
+	r, c := row, col
+	for i := 0; i < length; i++ {
+		letter, ok := source.Cell(page, r, c)
+		if !ok {
+			return "", fmt.Errorf("length out of range: %d runs off the page after %d letters", length, i)
+		}
+		letters = append(letters, letter)
+		r += rowStep
+		c += colStep
+	}
+	return strings.ToLower(string(letters)), nil
+}
@@ -0,0 +1,155 @@
+package whcypher
+
+import (
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	source := Source{
+		{
+			[]rune("abc"),
+			[]rune("def"),
+			[]rune("ghi"),
+		},
+		{
+			[]rune("jkl"),
+		},
+	}
+
+	testCases := []struct {
+		description string
+		codes       [][5]int
+		expected    string
+		expectErr   bool
+	}{
+		{
+			description: "Right",
+			codes:       [][5]int{{0, 0, 0, 3, int(DirectionRight)}},
+			expected:    "abc",
+		},
+		{
+			description: "Missing direction defaults to right",
+			codes:       [][5]int{{0, 1, 1, 2, 0}},
+			expected:    "ef",
+		},
+		{
+			description: "All directions",
+			codes: [][5]int{
+				{0, 2, 2, 3, int(DirectionLeft)},
+				{0, 2, 0, 3, int(DirectionUp)},
+				{0, 0, 2, 3, int(DirectionDown)},
+				{0, 0, 0, 3, int(DirectionRightDown)},
+				{0, 0, 2, 3, int(DirectionLeftDown)},
+				{0, 2, 0, 3, int(DirectionRightUp)},
+				{0, 2, 2, 3, int(DirectionLeftUp)},
+			},
+			expected: "ihg" + "gda" + "cfi" + "aei" + "ceg" + "gec" + "iea",
+		},
+		{
+			description: "Multiple pages",
+			codes:       [][5]int{{1, 0, 1, 2, int(DirectionRight)}, {0, 0, 0, 1, int(DirectionRight)}},
+			expected:    "kla",
+		},
+		{
+			description: "Page out of range",
+			codes:       [][5]int{{2, 0, 0, 1, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Row out of range",
+			codes:       [][5]int{{1, 1, 0, 1, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Column out of range",
+			codes:       [][5]int{{0, 0, -1, 1, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Length out of range",
+			codes:       [][5]int{{0, 0, 1, 3, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Length far past the page",
+			codes:       [][5]int{{0, 0, 0, 1 << 40, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Zero length",
+			codes:       [][5]int{{0, 0, 0, 0, int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Combined direction",
+			codes:       [][5]int{{0, 0, 0, 1, int(DirectionRight | DirectionDown)}},
+			expectErr:   true,
+		},
+		{
+			description: "Negative direction",
+			codes:       [][5]int{{0, 0, 0, 2, -255}},
+			expectErr:   true,
+		},
+		{
+			description: "Direction past a byte",
+			codes:       [][5]int{{0, 0, 0, 2, 2<<8 | int(DirectionRight)}},
+			expectErr:   true,
+		},
+		{
+			description: "Wrapped",
+			codes: [][5]int{
+				{0, 0, 2, 3, int(DirectionRight) | WrapBit},
+				{0, 0, 1, 2, int(DirectionUp) | WrapBit},
+				{0, 2, 2, 3, int(DirectionRightDown) | WrapBit},
+				{0, 1, 0, 2, int(DirectionLeftUp) | WrapBit},
+			},
+			expected: "cab" + "bh" + "iae" + "dc",
+		},
+		{
+			description: "Wrapped back to the first letter",
+			codes:       [][5]int{{0, 0, 0, 4, int(DirectionRight) | WrapBit}},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := Decode(source, tc.codes)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecode_RoundTrip(t *testing.T) {
+	rows := []string{"fghooo", "ooabco", "oodeoo"}
+	source := Source{{}}
+	trie := NewTrie()
+	for i, row := range rows {
+		source[0] = append(source[0], []rune(row))
+		trie.InsertPageRow(DirectionRight, 0, i, row)
+	}
+
+	phrase := "abcdefgh"
+	code, err := trie.ConstructPhraseLongest(phrase, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := Decode(source, code)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != phrase {
+		t.Errorf("Expected %q, got %q", phrase, result)
+	}
+}
@@ -0,0 +1,247 @@
+package whcypher
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UnencodableError explains why a phrase has no code in the enabled
+// directions.
+type UnencodableError struct {
+	// Phrase is the phrase as encoded, lower case without spaces.
+	Phrase string
+	// Dir is the enabled directions.
+	Dir Direction
+	// Built is the directions searched for the missing runs, those the
+	// trie was built for unless the source was searched too.
+	Built Direction
+	// Missing has each letter, and each pair of adjacent letters, of the
+	// phrase without a location in Dir, in phrase order. Pairs are only
+	// listed when both of their letters are found.
+	Missing []MissingRun
+}
+
+// MissingRun is a letter or pair of letters of a phrase without a location.
+type MissingRun struct {
+	// Index is the position of the run in the phrase, counted in letters.
+	Index   int
+	Letters string
+	// Directions holds the directions the run is found in, 0 when the
+	// trie does not have it in any direction it was built for.
+	Directions Direction
+	// Pages lists the pages the run is found on in those directions,
+	// counted from 0.
+	Pages []int
+}
+
+// Letters returns the missing single letters.
+func (e *UnencodableError) Letters() []MissingRun {
+	letters := []MissingRun{}
+	for _, m := range e.Missing {
+		if len([]rune(m.Letters)) == 1 {
+			letters = append(letters, m)
+		}
+	}
+	return letters
+}
+
+// Directions returns every direction that would find at least one of the
+// missing runs.
+func (e *UnencodableError) Directions() Direction {
+	var dir Direction
+	for _, m := range e.Missing {
+		dir |= m.Directions
+	}
+	return dir
+}
+
+func (e *UnencodableError) Error() string {
+	var letters []string
+	for _, m := range e.Letters() {
+		letters = append(letters, m.Letters)
+	}
+	if len(letters) == 1 {
+		return "letter not found: " + letters[0]
+	}
+	if len(letters) > 1 {
+		return "letters not found: " + strings.Join(letters, ", ")
+	}
+
+	var pairs []string
+	for _, m := range e.Missing {
+		pairs = append(pairs, m.Letters)
+	}
+	return "letters not found together: " + strings.Join(pairs, ", ")
+}
+
+// Report describes every missing run on its own line, with the directions
+// and pages that have it. Pages are numbered from pageOffset, as in codes.
+func (e *UnencodableError) Report(pageOffset int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Unable to encode %q reading %s:\n", e.Phrase, directionList(e.Dir))
+	for _, m := range e.Missing {
+		position := "letter " + strconv.Itoa(m.Index+1)
+		if n := len([]rune(m.Letters)); n > 1 {
+			position = fmt.Sprintf("letters %d-%d", m.Index+1, m.Index+n)
+		}
+		fmt.Fprintf(&b, "  %q (%s) ", m.Letters, position)
+
+		if m.Directions == 0 {
+			b.WriteString("is not in the source in any indexed direction\n")
+		} else {
+			fmt.Fprintf(&b, "is found reading %s on %s\n", directionList(m.Directions), pageList(m.Pages, pageOffset))
+		}
+	}
+	if dir := e.Directions(); dir != 0 {
+		fmt.Fprintf(&b, "Enabling %s would find some of them.\n", directionList(dir))
+	}
+	if e.Built != DirectionAll {
+		fmt.Fprintf(&b, "The trie only has %s, so other directions were not searched.\n", directionList(e.Built))
+	}
+	return b.String()
+}
+
+// Diagnose returns the letters and pairs of letters of the phrase that have
+// no location in the directions in dir. The report is nil when every one of
+// them is found.
+func (t *Trie) Diagnose(phrase string, dir Direction) (*UnencodableError, error) {
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	return t.diagnose(strippedPhrase, dir), nil
+}
+
+func (t *Trie) diagnose(phrase []rune, dir Direction) *UnencodableError {
+	e := &UnencodableError{Phrase: string(phrase), Dir: dir, Built: t.Directions()}
+
+	missing := map[string]bool{}
+	found := make([]bool, len(phrase))
+	for i := range phrase {
+		run := phrase[i : i+1]
+		if t.hasRun(run, dir) {
+			found[i] = true
+			continue
+		}
+		if !missing[string(run)] {
+			missing[string(run)] = true
+			e.Missing = append(e.Missing, t.missingRun(i, run, dir))
+		}
+	}
+	for i := 0; i+1 < len(phrase); i++ {
+		run := phrase[i : i+2]
+		if !found[i] || !found[i+1] || missing[string(run)] {
+			continue
+		}
+		if !t.hasRun(run, dir) {
+			missing[string(run)] = true
+			e.Missing = append(e.Missing, t.missingRun(i, run, dir))
+		}
+	}
+	if len(e.Missing) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(e.Missing, func(a, b MissingRun) int {
+		return a.Index - b.Index
+	})
+	return e
+}
+
+// DiagnoseSource is Diagnose, also searching the source for the missing runs
+// in the directions the trie was not built for. Those are indexed in a suffix
+// index that is dropped afterwards, so the trie does not grow. The source
+// must be the one the trie was built from.
+func (t *Trie) DiagnoseSource(source Source, phrase string, dir Direction) (*UnencodableError, error) {
+	report, err := t.Diagnose(phrase, dir)
+	if err != nil || report == nil {
+		return report, err
+	}
+	extra := DirectionAll &^ report.Built
+	if extra == 0 {
+		return report, nil
+	}
+
+	index, err := newSuffixIndex(source, extra, t.alphabet, t.wrap)
+	if err != nil {
+		return nil, err
+	}
+	for i := range report.Missing {
+		m := &report.Missing[i]
+		addRunDirections(m, []rune(m.Letters), extra, index.search)
+	}
+	report.Built = DirectionAll
+	return report, nil
+}
+
+// hasRun reports whether the run has a location in dir, counting them
+// without building the list of locations.
+func (t *Trie) hasRun(run []rune, dir Direction) bool {
+	return len(t.runCandidates(run, dir)) == len(run)
+}
+
+// missingRun looks up the run in every built direction other than dir.
+func (t *Trie) missingRun(index int, run []rune, dir Direction) MissingRun {
+	m := MissingRun{Index: index, Letters: string(run)}
+	addRunDirections(&m, run, t.Directions()&^dir, t.searchRunes)
+	return m
+}
+
+// addRunDirections adds each direction in dir that search finds the run in
+// to m, with the pages it is on.
+func addRunDirections(m *MissingRun, run []rune, dir Direction, search func([]rune, Direction) (int, [][5]int)) {
+	pages := map[int]bool{}
+	for _, p := range m.Pages {
+		pages[p] = true
+	}
+	for _, d := range dir.Directions() {
+		n, locations := search(run, d)
+		if n < len(run) || len(locations) == 0 {
+			continue
+		}
+		m.Directions |= d
+		for _, l := range locations {
+			pages[l[0]] = true
+		}
+	}
+	m.Pages = m.Pages[:0]
+	for p := range pages {
+		m.Pages = append(m.Pages, p)
+	}
+	slices.Sort(m.Pages)
+}
+
+// checkLetters returns the UnencodableError for the phrase when one of its
+// letters has no location.
+func (t *Trie) checkLetters(phrase []rune, dir Direction) error {
+	e := t.diagnose(phrase, dir)
+	if e == nil || len(e.Letters()) == 0 {
+		return nil
+	}
+	return e
+}
+
+// splitError is the error for a phrase that can not be split into runs of
+// the lengths allowed by opts.
+func (t *Trie) splitError(phrase []rune, dir Direction, opts EncodeOptions) error {
+	if e := t.diagnose(phrase, dir); e != nil {
+		return fmt.Errorf("unable to split phrase into runs of %s letters: %w", opts.lengthRange(), e)
+	}
+	return fmt.Errorf("unable to split phrase into runs of %s letters: %s", opts.lengthRange(), string(phrase))
+}
+
+func directionList(dir Direction) string {
+	return strings.ReplaceAll(dir.String(), "|", ", ")
+}
+
+func pageList(pages []int, offset int) string {
+	list := make([]string, len(pages))
+	for i, p := range pages {
+		list[i] = strconv.Itoa(p + offset)
+	}
+	if len(list) == 1 {
+		return "page " + list[0]
+	}
+	return "pages " + strings.Join(list, ", ")
+}
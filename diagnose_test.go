@@ -0,0 +1,165 @@
+package whcypher
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func missingLetterTrie(t *testing.T) *Trie {
+	t.Helper()
+	f, err := os.Open("data/missing_letter.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer f.Close()
+
+	source, err := ParseSource(f)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return trie
+}
+
+func TestTrie_Diagnose(t *testing.T) {
+	trie := missingLetterTrie(t)
+
+	testCases := []struct {
+		description string
+		phrase      string
+		dir         Direction
+		expected    []MissingRun
+	}{
+		{
+			description: "Found",
+			phrase:      "abc",
+			dir:         DirectionRight,
+		},
+		{
+			description: "Missing letter",
+			phrase:      "klzz",
+			dir:         DirectionRight,
+			expected: []MissingRun{
+				{Index: 2, Letters: "z"},
+			},
+		},
+		{
+			description: "Missing pair",
+			phrase:      "apb",
+			dir:         DirectionRight,
+			expected: []MissingRun{
+				{Index: 0, Letters: "ap", Directions: DirectionDown, Pages: []int{0}},
+				{Index: 1, Letters: "pb", Directions: DirectionRightUp, Pages: []int{0}},
+			},
+		},
+		{
+			description: "Pair found in enabled direction",
+			phrase:      "apb",
+			dir:         DirectionDown | DirectionRightUp,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := trie.Diagnose(tc.phrase, tc.dir)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tc.expected == nil {
+				if result != nil {
+					t.Errorf("Expected nothing missing, got %v", result.Missing)
+				}
+				return
+			}
+			if result == nil {
+				t.Fatal("Expected missing runs, got nil")
+			}
+			if diff := cmp.Diff(result.Missing, tc.expected); diff != "" {
+				t.Errorf("Expected missing runs to match, got diff (-got,+want) %s", diff)
+			}
+		})
+	}
+}
+
+func TestTrie_Encode_Unencodable(t *testing.T) {
+	trie := missingLetterTrie(t)
+
+	_, err := trie.ConstructPhraseLTR("lazy", DirectionRight)
+	var unencodable *UnencodableError
+	if !errors.As(err, &unencodable) {
+		t.Fatalf("Expected unencodable error, got %v", err)
+	}
+	if err.Error() != "letter not found: z" {
+		t.Errorf("Expected letter not found: z, got %q", err.Error())
+	}
+
+	_, err = trie.Encode("apb", DirectionRight, EncodeOptions{MinLen: 2})
+	if !errors.As(err, &unencodable) {
+		t.Fatalf("Expected unencodable error, got %v", err)
+	}
+	if unencodable.Directions() != DirectionDown|DirectionRightUp {
+		t.Errorf("Expected down and right-up to help, got %v", unencodable.Directions())
+	}
+
+	expected := `Unable to encode "apb" reading right:
+  "ap" (letters 1-2) is found reading down on page 3
+  "pb" (letters 2-3) is found reading right-up on page 3
+Enabling down, right-up would find some of them.
+`
+	if diff := cmp.Diff(unencodable.Report(3), expected); diff != "" {
+		t.Errorf("Expected report to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestTrie_Diagnose_AddDirections(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("def"), []rune("ghi")}}
+	trie, err := NewTrieFromSource(source, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Only the built directions are searched for the missing runs.
+	result, err := trie.Diagnose("adg", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result == nil || result.Directions() != 0 {
+		t.Fatalf("Expected no direction to help, got %v", result)
+	}
+
+	if err := trie.AddDirections(source, DirectionAll); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err = trie.Diagnose("adg", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result == nil || result.Directions() != DirectionDown {
+		t.Errorf("Expected down to help, got %v", result)
+	}
+}
+
+func TestTrie_DiagnoseSource(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("def"), []rune("ghi")}}
+	trie, err := NewTrieFromSource(source, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result, err := trie.DiagnoseSource(source, "adg", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result == nil || result.Directions() != DirectionDown || result.Built != DirectionAll {
+		t.Fatalf("Expected down to help after searching every direction, got %v", result)
+	}
+	if trie.Directions() != DirectionRight {
+		t.Errorf("Expected the trie to keep only right, got %v", trie.Directions())
+	}
+}
@@ -0,0 +1,533 @@
+package whcypher
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Strategy chooses how a phrase is split into runs.
+type Strategy int
+
+const (
+	// StrategyLTR takes the longest run from the start of the phrase each time.
+	StrategyLTR Strategy = iota
+	// StrategyLongest takes the longest run anywhere in the phrase and
+	// splits the rest around it.
+	StrategyLongest
+	// StrategyOptimal uses the fewest runs possible.
+	StrategyOptimal
+)
+
+// maxSearchSteps bounds the candidates the backtracking search used when
+// locations are constrained may try, as some phrases have no answer and
+// exponentially many ways to find that out.
+const maxSearchSteps = 1_000_000
+
+// EncodeOptions configures Trie.Encode.
+type EncodeOptions struct {
+	Strategy Strategy
+
+	// NoReuse forbids the same location appearing twice in one code.
+	NoReuse bool
+	// NoOverlap forbids two locations in one code sharing any cell.
+	NoOverlap bool
+
+	// Ledger holds locations used by earlier codes. They are only tried
+	// once every unused candidate for a run has been tried. An empty ledger
+	// is no constraint.
+	Ledger *Ledger
+	// AvoidLedger forbids locations in Ledger altogether.
+	AvoidLedger bool
+
+	// MinLen and MaxLen bound the number of letters in each run. 0 means no
+	// bound.
+	MinLen int
+	MaxLen int
+}
+
+// constrained reports whether the options restrict which locations can be
+// combined, needing a backtracking search.
+func (o EncodeOptions) constrained() bool {
+	return o.constrainsLocations() || o.MinLen > 1 || o.MaxLen > 0
+}
+
+// constrainsLocations reports whether the options restrict which locations
+// can be used, beyond the lengths of their runs.
+func (o EncodeOptions) constrainsLocations() bool {
+	return o.NoReuse || o.NoOverlap || (o.Ledger != nil && o.Ledger.Len() > 0)
+}
+
+// Encode encodes the phrase with the strategy and constraints in opts.
+//
+// When locations or run lengths are constrained, LTR searches left to right
+// and Longest around the longest run, both falling back to other candidates
+// and then shorter runs, while Optimal returns the fewest runs that satisfy
+// the constraints. When that takes more than maxSearchSteps candidates,
+// Longest and Optimal return the left to right cover, Optimal a shorter one
+// if found by then. When the left to right search itself gives up, the error
+// matches ErrSearchLimit, as a cover may still exist.
+func (t *Trie) Encode(phrase string, dir Direction, opts EncodeOptions) ([]Location, error) {
+	if err := opts.checkLengths(); err != nil {
+		return nil, err
+	}
+	if !opts.constrained() {
+		switch opts.Strategy {
+		case StrategyLongest:
+			return t.EncodeLongest(phrase, dir)
+		case StrategyOptimal:
+			return t.EncodeOptimal(phrase, dir)
+		default:
+			return t.EncodeLTR(phrase, dir)
+		}
+	}
+
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	longest, err := t.longestRuns(strippedPhrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	segments, next := fewestSegments(longest, opts.MinLen, opts.MaxLen)
+	if next[0] == 0 {
+		return nil, t.splitError(strippedPhrase, dir, opts)
+	}
+
+	if opts.NoOverlap {
+		if err := t.checkLetterCells(strippedPhrase, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &constrainedSearch{
+		trie:     t,
+		phrase:   strippedPhrase,
+		dir:      dir,
+		opts:     opts,
+		longest:  longest,
+		segments: segments,
+		next:     next,
+		runs:     make(map[[2]int][]Location),
+		parts:    make(map[[2]int]bool),
+		used:     make(map[Location]bool),
+		cells:    make(map[[3]int]bool),
+	}
+	switch opts.Strategy {
+	case StrategyLTR:
+		found, err := s.search(0)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return s.cover(), nil
+		}
+		return nil, s.noCoverError(phrase)
+	case StrategyLongest:
+		found, err := s.searchLongest([][2]int{{0, len(strippedPhrase)}})
+		if errors.Is(err, ErrSearchLimit) {
+			s = s.withStrategy(StrategyLTR)
+			found, err = s.search(0)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return s.cover(), nil
+		}
+		return nil, s.noCoverError(phrase)
+	}
+
+	// Optimal takes the left to right cover first, then searches for one
+	// with fewer runs, starting from as few as the unconstrained phrase
+	// would need. It settles for the best cover found when the search limit
+	// is reached.
+	ltr := s.withStrategy(StrategyLTR)
+	found, err := ltr.search(0)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ltr.noCoverError(phrase)
+	}
+	best := ltr.cover()
+	for s.bound = segments[0]; s.bound < len(best); s.bound++ {
+		found, err := s.search(0)
+		if errors.Is(err, ErrSearchLimit) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return s.cover(), nil
+		}
+	}
+	return best, nil
+}
+
+// checkLengths fails when the run length bounds can not be met.
+func (o EncodeOptions) checkLengths() error {
+	switch {
+	case o.MinLen < 0:
+		return fmt.Errorf("invalid run lengths: minimum %d is negative", o.MinLen)
+	case o.MaxLen < 0:
+		return fmt.Errorf("invalid run lengths: maximum %d is negative", o.MaxLen)
+	case o.MaxLen > 0 && o.MaxLen < o.MinLen:
+		return fmt.Errorf("invalid run lengths: minimum %d is above maximum %d", o.MinLen, o.MaxLen)
+	}
+	return nil
+}
+
+// lengthRange describes the run length bounds for errors.
+func (o EncodeOptions) lengthRange() string {
+	switch {
+	case o.MaxLen > 0 && o.MinLen > 1:
+		return fmt.Sprintf("%d to %d", o.MinLen, o.MaxLen)
+	case o.MaxLen > 0:
+		return fmt.Sprintf("at most %d", o.MaxLen)
+	default:
+		return fmt.Sprintf("at least %d", o.MinLen)
+	}
+}
+
+// checkLetterCells fails when the phrase uses a letter more often than there
+// are cells holding it, as no cover without overlap can exist then.
+func (t *Trie) checkLetterCells(phrase []rune, dir Direction) error {
+	need := map[rune]int{}
+	for _, r := range phrase {
+		need[r]++
+	}
+	for letter, n := range need {
+		_, locations, err := t.searchDir([]rune{letter}, dir)
+		if err != nil {
+			return err
+		}
+		cells := map[[3]int]bool{}
+		for _, l := range locations {
+			cells[[3]int{l[0], l[1], l[2]}] = true
+		}
+		if len(cells) < n {
+			return fmt.Errorf("unable to complete phrase without overlap: %q is needed %d times but found in %d cells", letter, n, len(cells))
+		}
+	}
+	return nil
+}
+
+// constrainedSearch is a backtracking search for a cover of the phrase where
+// the chosen locations satisfy the encode options.
+type constrainedSearch struct {
+	trie     *Trie
+	phrase   []rune
+	dir      Direction
+	opts     EncodeOptions
+	longest  []int
+	segments []int
+	next     []int
+
+	// bound is the most runs allowed, 0 for no limit.
+	bound int
+	// steps counts the candidates tried, across every bound.
+	steps int
+
+	// runs caches the candidates of the run of each position and length.
+	runs map[[2]int][]Location
+	// parts caches whether the phrase between two positions can be split
+	// into runs on its own.
+	parts map[[2]int]bool
+
+	// chosen holds the locations in the order they were picked and starts
+	// the position of the run each covers.
+	chosen []Location
+	starts []int
+	used   map[Location]bool
+	cells  map[[3]int]bool
+}
+
+// withStrategy returns a fresh search of the same phrase ordering run
+// lengths for strategy, sharing the candidate cache.
+func (s *constrainedSearch) withStrategy(strategy Strategy) *constrainedSearch {
+	c := *s
+	c.opts.Strategy = strategy
+	c.bound, c.steps = 0, 0
+	c.chosen, c.starts = nil, nil
+	c.used = make(map[Location]bool)
+	c.cells = make(map[[3]int]bool)
+	return &c
+}
+
+func (s *constrainedSearch) search(i int) (bool, error) {
+	if i == len(s.phrase) {
+		return true, nil
+	}
+	if s.bound > 0 && len(s.chosen)+s.segments[i] > s.bound {
+		return false, nil
+	}
+
+	for _, l := range s.lengths(i) {
+		for _, loc := range s.candidates(i, l) {
+			s.steps++
+			if s.steps > maxSearchSteps {
+				return false, fmt.Errorf("%w encoding phrase: %s", ErrSearchLimit, string(s.phrase))
+			}
+			if !s.allowed(loc) {
+				continue
+			}
+
+			s.take(i, loc)
+			if found, err := s.search(i + l); err != nil || found {
+				return found, err
+			}
+			s.release(loc)
+
+			// Without NoOverlap the rest of the phrase only cares how many
+			// locations of this run are used, not which, so if one of them
+			// fails the others will too.
+			if !s.opts.NoOverlap {
+				break
+			}
+		}
+	}
+	return false, nil
+}
+
+// searchLongest covers the parts of the phrase left, given as start and end
+// positions, taking the last first. Each part is split around the run tried
+// first by ConstructPhraseLongest, then around shorter runs, and its prefix
+// is covered before its suffix.
+func (s *constrainedSearch) searchLongest(parts [][2]int) (bool, error) {
+	if len(parts) == 0 {
+		return true, nil
+	}
+	a, b := parts[len(parts)-1][0], parts[len(parts)-1][1]
+	rest := parts[:len(parts)-1]
+
+	for _, run := range s.longestFirst(a, b) {
+		i, l := run[0], run[1]
+		for _, loc := range s.candidates(i, l) {
+			s.steps++
+			if s.steps > maxSearchSteps {
+				return false, fmt.Errorf("%w encoding phrase: %s", ErrSearchLimit, string(s.phrase))
+			}
+			if !s.allowed(loc) {
+				continue
+			}
+
+			s.take(i, loc)
+			left := slices.Clone(rest)
+			if i+l < b {
+				left = append(left, [2]int{i + l, b})
+			}
+			if a < i {
+				left = append(left, [2]int{a, i})
+			}
+			if found, err := s.searchLongest(left); err != nil || found {
+				return found, err
+			}
+			s.release(loc)
+
+			// As in search, the other locations of this run fail too.
+			if !s.opts.NoOverlap {
+				break
+			}
+		}
+	}
+	return false, nil
+}
+
+// longestFirst returns the runs between positions a and b, as position and
+// length, in the order searchLongest tries them, leaving out any that leave
+// a prefix or suffix that can not be split. Like findLongest it prefers the
+// first run longer than half the part, and otherwise the first of the
+// longest runs.
+func (s *constrainedSearch) longestFirst(a, b int) [][2]int {
+	runs := [][2]int{}
+	for i := a; i < b; i++ {
+		for _, l := range segmentLengths(min(s.longest[i], b-i), s.opts.MinLen, s.opts.MaxLen) {
+			if s.splittable(a, i) && s.splittable(i+l, b) {
+				runs = append(runs, [2]int{i, l})
+			}
+		}
+	}
+
+	half := (b - a) / 2
+	slices.SortStableFunc(runs, func(x, y [2]int) int {
+		switch xl, yl := x[1] > half, y[1] > half; {
+		case xl && !yl:
+			return -1
+		case yl && !xl:
+			return 1
+		case xl && x[0] != y[0]:
+			return x[0] - y[0]
+		case xl:
+			return y[1] - x[1]
+		case x[1] != y[1]:
+			return y[1] - x[1]
+		default:
+			return x[0] - y[0]
+		}
+	})
+	return runs
+}
+
+// splittable reports whether the phrase between positions a and b can be
+// split into runs that do not cross either end.
+func (s *constrainedSearch) splittable(a, b int) bool {
+	// Every letter is a run on its own.
+	if a == b || s.opts.MinLen <= 1 {
+		return true
+	}
+	key := [2]int{a, b}
+	if ok, found := s.parts[key]; found {
+		return ok
+	}
+
+	ends := make([]bool, b-a+1)
+	ends[b-a] = true
+	for i := b - 1; i >= a; i-- {
+		for _, l := range segmentLengths(min(s.longest[i], b-i), s.opts.MinLen, s.opts.MaxLen) {
+			if ends[i+l-a] {
+				ends[i-a] = true
+				break
+			}
+		}
+	}
+	s.parts[key] = ends[0]
+	return ends[0]
+}
+
+// cover returns the chosen locations in the order of the phrase.
+func (s *constrainedSearch) cover() []Location {
+	order := make([]int, len(s.chosen))
+	for k := range order {
+		order[k] = k
+	}
+	slices.SortFunc(order, func(x, y int) int {
+		return s.starts[x] - s.starts[y]
+	})
+
+	locs := make([]Location, len(order))
+	for k, o := range order {
+		locs[k] = s.chosen[o]
+	}
+	return locs
+}
+
+// noCoverError reports that no cover of the phrase satisfies the
+// constraints in force.
+func (s *constrainedSearch) noCoverError(phrase string) error {
+	avoided := []string{}
+	if s.opts.NoReuse {
+		avoided = append(avoided, "reusing locations")
+	}
+	if s.opts.NoOverlap {
+		avoided = append(avoided, "overlapping cells")
+	}
+	if s.opts.AvoidLedger {
+		avoided = append(avoided, "using ledger entries")
+	}
+
+	msg := "unable to complete phrase"
+	if len(avoided) > 0 {
+		msg += " without " + strings.Join(avoided, " or ")
+	}
+	// candidates caches no locations for the runs the selector rejected.
+	for _, locs := range s.runs {
+		if locs == nil {
+			msg += ", no location accepted by the selector for some runs"
+			break
+		}
+	}
+	return errors.New(msg + ": " + phrase)
+}
+
+// lengths returns the run lengths to try from position i, in order, leaving
+// out any after which the rest of the phrase can not be split.
+func (s *constrainedSearch) lengths(i int) []int {
+	lengths := []int{}
+	for _, l := range segmentLengths(s.longest[i], s.opts.MinLen, s.opts.MaxLen) {
+		if i+l == len(s.phrase) || s.next[i+l] != 0 {
+			lengths = append(lengths, l)
+		}
+	}
+	if s.opts.Strategy == StrategyOptimal {
+		slices.SortStableFunc(lengths, func(a, b int) int {
+			return s.segments[i+a] - s.segments[i+b]
+		})
+	}
+	return lengths
+}
+
+// candidates returns the locations of the run of l letters at position i in
+// the order to try them, starting from the trie's location selector and
+// moving locations used in the ledger to the end. It is empty when the
+// selector rejects them all. The order is worked out the first time the run
+// is reached and reused from then on.
+func (s *constrainedSearch) candidates(i, l int) []Location {
+	key := [2]int{i, l}
+	if locs, ok := s.runs[key]; ok {
+		return locs
+	}
+
+	run := s.phrase[i : i+l]
+	_, raw := s.trie.searchRunes(run, s.dir)
+	found := LocationsFromRaw(raw)
+	start := s.trie.selectLocation(found, string(run), s.chosen)
+	if start < 0 {
+		s.runs[key] = nil
+		return nil
+	}
+
+	locs := make([]Location, len(found))
+	for k := range found {
+		locs[k] = found[(start+k)%len(found)]
+	}
+	if s.opts.Ledger != nil {
+		slices.SortStableFunc(locs, func(a, b Location) int {
+			return s.opts.Ledger.Count(a) - s.opts.Ledger.Count(b)
+		})
+	}
+	s.runs[key] = locs
+	return locs
+}
+
+func (s *constrainedSearch) allowed(loc Location) bool {
+	if s.opts.AvoidLedger && s.opts.Ledger.Count(loc) > 0 {
+		return false
+	}
+	if s.opts.NoReuse && s.used[loc] {
+		return false
+	}
+	if s.opts.NoOverlap {
+		for _, c := range s.trie.cells(loc) {
+			if s.cells[c] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *constrainedSearch) take(i int, loc Location) {
+	s.chosen = append(s.chosen, loc)
+	s.starts = append(s.starts, i)
+	s.used[loc] = true
+	if s.opts.NoOverlap {
+		for _, c := range s.trie.cells(loc) {
+			s.cells[c] = true
+		}
+	}
+}
+
+func (s *constrainedSearch) release(loc Location) {
+	s.chosen = s.chosen[:len(s.chosen)-1]
+	s.starts = s.starts[:len(s.starts)-1]
+	delete(s.used, loc)
+	if s.opts.NoOverlap {
+		for _, c := range s.trie.cells(loc) {
+			delete(s.cells, c)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package whcypher
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrie_Encode(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		description string
+		pageRows    []string
+		searchWord  string
+		opts        EncodeOptions
+		expected    []Location
+		expectErr   bool
+	}{
+		{
+			description: "Unconstrained reuses locations",
+			pageRows:    []string{"abcab"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "No reuse picks another candidate",
+			pageRows:    []string{"abcab"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{NoReuse: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 3, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "No reuse falls back to shorter runs",
+			pageRows:    []string{"abo", "oao", "obo"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{NoReuse: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "No overlap avoids shared cells",
+			pageRows:    []string{"abo", "oao", "obo"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{NoOverlap: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 1, Col: 1, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 2, Col: 1, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "No overlap impossible",
+			pageRows:    []string{"ab"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{NoOverlap: true},
+			expectErr:   true,
+		},
+		{
+			description: "Missing char",
+			pageRows:    []string{"ab"},
+			searchWord:  "abc",
+			opts:        EncodeOptions{NoReuse: true},
+			expectErr:   true,
+		},
+		{
+			description: "Minimum length",
+			pageRows:    []string{"abcdeo", "oocdeo", "abcooo"},
+			searchWord:  "abcde",
+			opts:        EncodeOptions{MinLen: 2, MaxLen: 3},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 3, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 3, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "Minimum length leaves no short tail",
+			pageRows:    []string{"abcdxo", "deoooo"},
+			searchWord:  "abcde",
+			opts:        EncodeOptions{MinLen: 2},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 3, Dir: DirectionRight}, {Page: 0, Row: 1, Col: 0, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "Maximum length",
+			pageRows:    []string{"abcdef"},
+			searchWord:  "abcdef",
+			opts:        EncodeOptions{Strategy: StrategyOptimal, MaxLen: 4},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 4, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 4, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "No split within lengths",
+			pageRows:    []string{"abcde"},
+			searchWord:  "aec",
+			opts:        EncodeOptions{MinLen: 2},
+			expectErr:   true,
+		},
+		{
+			description: "Minimum above maximum",
+			pageRows:    []string{"abcde"},
+			searchWord:  "abc",
+			opts:        EncodeOptions{MinLen: 3, MaxLen: 2},
+			expectErr:   true,
+		},
+		{
+			description: "Negative minimum",
+			pageRows:    []string{"abcde"},
+			searchWord:  "abc",
+			opts:        EncodeOptions{MinLen: -1},
+			expectErr:   true,
+		},
+		{
+			description: "Negative maximum",
+			pageRows:    []string{"abcde"},
+			searchWord:  "abc",
+			opts:        EncodeOptions{MaxLen: -1},
+			expectErr:   true,
+		},
+		{
+			description: "Longest with a maximum length that has no effect",
+			pageRows:    []string{"ooh", "ooabco", "oooo", "bcdefg"},
+			searchWord:  "abcdefgh",
+			opts:        EncodeOptions{Strategy: StrategyLongest, MaxLen: 100},
+			expected:    []Location{{Page: 0, Row: 1, Col: 2, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 3, Col: 0, Len: 6, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "Longest with no reuse",
+			pageRows:    []string{"ooh", "ooabco", "oooo", "bcdefg"},
+			searchWord:  "abcdefgh",
+			opts:        EncodeOptions{Strategy: StrategyLongest, NoReuse: true},
+			expected:    []Location{{Page: 0, Row: 1, Col: 2, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 3, Col: 0, Len: 6, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "LTR with no reuse",
+			pageRows:    []string{"ooh", "ooabco", "oooo", "bcdefg"},
+			searchWord:  "abcdefgh",
+			opts:        EncodeOptions{Strategy: StrategyLTR, NoReuse: true},
+			expected:    []Location{{Page: 0, Row: 1, Col: 2, Len: 3, Dir: DirectionRight}, {Page: 0, Row: 3, Col: 2, Len: 4, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "Longest with a maximum length",
+			pageRows:    []string{"ooh", "ooabco", "oooo", "bcdefg"},
+			searchWord:  "abcdefgh",
+			opts:        EncodeOptions{Strategy: StrategyLongest, MaxLen: 4},
+			expected:    []Location{{Page: 0, Row: 1, Col: 2, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 3, Col: 0, Len: 4, Dir: DirectionRight}, {Page: 0, Row: 3, Col: 4, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "Longest with no reuse falls back to shorter runs",
+			pageRows:    []string{"abo", "oao", "obo"},
+			searchWord:  "abab",
+			opts:        EncodeOptions{Strategy: StrategyLongest, NoReuse: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight}},
+		},
+		{
+			description: "Optimal with no reuse",
+			pageRows:    []string{"abcdab", "cdoooo"},
+			searchWord:  "abcdabcd",
+			opts:        EncodeOptions{Strategy: StrategyOptimal, NoOverlap: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 6, Dir: DirectionRight}, {Page: 0, Row: 1, Col: 0, Len: 2, Dir: DirectionRight}},
+		},
+		{
+			description: "Optimal needs more runs than unconstrained",
+			pageRows:    []string{"abcd", "aboo", "cdoo"},
+			searchWord:  "abcdabcd",
+			opts:        EncodeOptions{Strategy: StrategyOptimal, NoOverlap: true},
+			expected:    []Location{{Page: 0, Row: 0, Col: 0, Len: 4, Dir: DirectionRight}, {Page: 0, Row: 1, Col: 0, Len: 2, Dir: DirectionRight}, {Page: 0, Row: 2, Col: 0, Len: 2, Dir: DirectionRight}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			trie := NewTrie()
+			for i, row := range tc.pageRows {
+				trie.InsertPageRow(DirectionRight, 0, i, row)
+			}
+			result, err := trie.Encode(tc.searchWord, DirectionRight, tc.opts)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if diff := cmp.Diff(result, tc.expected); diff != "" {
+				t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+			}
+		})
+	}
+}
+
+func TestTrie_Encode_NoOverlapAllDirections(t *testing.T) {
+	source := testSource(t)
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	phrase := "born in a cold land"
+	for _, strategy := range []Strategy{StrategyLTR, StrategyLongest, StrategyOptimal} {
+		result, err := trie.Encode(phrase, DirectionAll, EncodeOptions{Strategy: strategy, NoOverlap: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		cells := map[[3]int]bool{}
+		for _, loc := range result {
+			for _, c := range loc.Cells() {
+				if cells[c] {
+					t.Errorf("Expected no shared cells, got %v twice", c)
+				}
+				cells[c] = true
+			}
+		}
+
+		decoded, err := DecodeLocations(source, result)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if decoded != strings.ReplaceAll(phrase, " ", "") {
+			t.Errorf("Expected %q to decode, got %q", phrase, decoded)
+		}
+	}
+}
+
+func TestTrie_Encode_NoOverlapNotEnoughLetters(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "eab")
+	trie.InsertPageRow(DirectionRight, 0, 1, "eoo")
+
+	_, err := trie.Encode("eee", DirectionRight, EncodeOptions{NoOverlap: true})
+	if err == nil || !strings.Contains(err.Error(), "needed 3 times but found in 2 cells") {
+		t.Errorf("Expected not enough cells error, got %v", err)
+	}
+}
+
+func TestTrie_Encode_OptimalNoReuseRepeatedPhrase(t *testing.T) {
+	f, err := os.Open("data/random.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer f.Close()
+	source, err := ParseSource(f)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	index, err := NewSuffixIndex(source[:500], DirectionRight, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie := NewTrieWithIndex(index)
+
+	// Every run of a repeated phrase has many interchangeable locations,
+	// which the search must not try one by one.
+	phrase := strings.Repeat("the quick brown fox jumps over the lazy dog and then meets the other animals at the river bank", 3)
+	ltr, err := trie.Encode(phrase, DirectionRight, EncodeOptions{NoReuse: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	start := time.Now()
+	result, err := trie.Encode(phrase, DirectionRight, EncodeOptions{Strategy: StrategyOptimal, NoReuse: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("Expected the search to be bounded, took %v", elapsed)
+	}
+	if len(result) > len(ltr) {
+		t.Errorf("Expected at most %d runs, got %d", len(ltr), len(result))
+	}
+
+	used := map[Location]bool{}
+	for _, loc := range result {
+		if used[loc] {
+			t.Errorf("Expected no reused locations, got %v twice", loc)
+		}
+		used[loc] = true
+	}
+	decoded, err := DecodeLocations(source, result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if decoded != strings.ReplaceAll(phrase, " ", "") {
+		t.Errorf("Expected %q to decode, got %q", phrase, decoded)
+	}
+}
+
+func TestTrie_Encode_LongestUnaffectedByConstraints(t *testing.T) {
+	source := testSource(t)
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, phrase := range []string{"born in a cold land", "a plan for the morning", "snow on the river bank"} {
+		expected, err := trie.EncodeLongest(phrase, DirectionAll)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result, err := trie.Encode(phrase, DirectionAll, EncodeOptions{Strategy: StrategyLongest, MaxLen: 100})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if diff := cmp.Diff(result, expected); diff != "" {
+			t.Errorf("Expected %q to match the unconstrained cover, got diff (-got,+want) %s", phrase, diff)
+		}
+	}
+}
+
+func TestTrie_Encode_NoCoverError(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "aba")
+	trie.InsertPageRow(DirectionRight, 0, 1, "bob")
+
+	_, err := trie.Encode("abab", DirectionRight, EncodeOptions{NoOverlap: true, MinLen: 2})
+	if err == nil || err.Error() != "unable to complete phrase without overlapping cells: abab" {
+		t.Errorf("Expected overlapping cells error, got %v", err)
+	}
+
+	trie.SetLocationSelector(LocationSelectorFunc(func(candidates []Location, run string, chosen []Location) int {
+		return -1
+	}))
+	_, err = trie.Encode("abab", DirectionRight, EncodeOptions{NoReuse: true})
+	if err == nil || err.Error() != "unable to complete phrase without reusing locations, no location accepted by the selector for some runs: abab" {
+		t.Errorf("Expected selector error, got %v", err)
+	}
+}
+
+func TestTrie_Encode_SearchLimit(t *testing.T) {
+	// Each "ab" of the phrase can use any of the rows but one is missing,
+	// which the search only finds after trying every order of the rows.
+	trie := NewTrie()
+	rows := 12
+	for i := 0; i < rows; i++ {
+		trie.InsertPageRow(DirectionRight, 0, i, "ab")
+	}
+	trie.InsertPageRow(DirectionRight, 0, rows, "xaxb")
+	phrase := strings.Repeat("ab", rows+1)
+
+	for _, strategy := range []Strategy{StrategyLTR, StrategyLongest, StrategyOptimal} {
+		result, err := trie.Encode(phrase, DirectionRight, EncodeOptions{Strategy: strategy, NoOverlap: true, MinLen: 2})
+		if !errors.Is(err, ErrSearchLimit) {
+			t.Errorf("Expected %v, got %v", ErrSearchLimit, err)
+		}
+		if result != nil {
+			t.Errorf("Expected no result, got %v", result)
+		}
+	}
+}
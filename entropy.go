@@ -0,0 +1,169 @@
+package whcypher
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// entropyExactLimit is the longest phrase counted exactly. Longer phrases
+// are estimated in floating point to keep numbers small.
+const entropyExactLimit = 512
+
+// EntropyReport describes how many codes a phrase has.
+type EntropyReport struct {
+	// Phrase is the phrase as encoded, lower case without spaces.
+	Phrase string
+	// Encodings is the number of distinct codes for the phrase, summed over
+	// every split into runs and every location of each run. It is nil when
+	// the count was estimated.
+	Encodings *big.Int
+	// Bits is log2 of the number of codes, the entropy of picking one of
+	// them uniformly at random.
+	Bits float64
+	// Exact is false when Bits was estimated.
+	Exact bool
+	// Positions has the choices covering each letter of Phrase.
+	Positions []PositionChoices
+}
+
+// PositionChoices counts the locations that can cover one letter of a phrase.
+type PositionChoices struct {
+	Index  int
+	Letter rune
+	// Choices is the number of distinct locations, across every run
+	// containing the letter, that can cover it.
+	Choices int
+	Bits    float64
+}
+
+// Weakest returns the n positions with the fewest choices, fewest first. It
+// returns none when n is not positive.
+func (r *EntropyReport) Weakest(n int) []PositionChoices {
+	if n <= 0 {
+		return nil
+	}
+	positions := slices.Clone(r.Positions)
+	slices.SortStableFunc(positions, func(a, b PositionChoices) int {
+		return a.Choices - b.Choices
+	})
+	return positions[:min(n, len(positions))]
+}
+
+// Entropy counts the codes the phrase has for the directions in dir.
+func (t *Trie) Entropy(phrase string, dir Direction) (*EntropyReport, error) {
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	n := len(strippedPhrase)
+
+	// candidates[i][l-1] is the number of locations of the run of length l
+	// starting at i.
+	candidates := make([][]int, n)
+	for i := range strippedPhrase {
+		candidates[i] = t.runCandidates(strippedPhrase[i:], dir)
+		if len(candidates[i]) == 0 {
+			if err := t.checkLetters(strippedPhrase, dir); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("letter not found: " + string(strippedPhrase[i]))
+		}
+	}
+
+	report := &EntropyReport{
+		Phrase:    string(strippedPhrase),
+		Positions: make([]PositionChoices, n),
+	}
+	for i := range report.Positions {
+		report.Positions[i] = PositionChoices{Index: i, Letter: strippedPhrase[i]}
+	}
+	for i, counts := range candidates {
+		for l, c := range counts {
+			for j := i; j <= i+l; j++ {
+				report.Positions[j].Choices += c
+			}
+		}
+	}
+	for i := range report.Positions {
+		report.Positions[i].Bits = math.Log2(float64(report.Positions[i].Choices))
+	}
+
+	if n <= entropyExactLimit {
+		report.Encodings = countEncodings(candidates)
+		report.Bits = bigLog2(report.Encodings)
+		report.Exact = true
+	} else {
+		report.Bits = estimateEncodingBits(candidates)
+	}
+	return report, nil
+}
+
+// runCandidates returns the number of locations for every run starting at
+// the beginning of the phrase, shortest first.
+func (t *Trie) runCandidates(phrase []rune, dir Direction) []int {
+	if t.index != nil {
+		return t.index.prefixCounts(phrase, dir)
+	}
+
+	counts := []int{}
+	current := t.RootNode
+	for _, r := range phrase {
+		index, _ := t.alphabet.Index(r)
+		next := current.Child(index)
+		if next == nil || next.LocDirections&dir == 0 {
+			break
+		}
+		current = next
+
+		c := 0
+		for _, d := range dir.Directions() {
+			c += len(current.KnownLoc[d])
+		}
+		counts = append(counts, c)
+	}
+	return counts
+}
+
+// countEncodings sums, over every split of the phrase into runs, the product
+// of the number of locations of each run.
+func countEncodings(candidates [][]int) *big.Int {
+	n := len(candidates)
+	count := make([]*big.Int, n+1)
+	count[n] = big.NewInt(1)
+	for i := n - 1; i >= 0; i-- {
+		count[i] = new(big.Int)
+		for l, c := range candidates[i] {
+			term := new(big.Int).Mul(big.NewInt(int64(c)), count[i+l+1])
+			count[i].Add(count[i], term)
+		}
+	}
+	return count[0]
+}
+
+// estimateEncodingBits is countEncodings in log2 space.
+func estimateEncodingBits(candidates [][]int) float64 {
+	n := len(candidates)
+	bits := make([]float64, n+1)
+	for i := n - 1; i >= 0; i-- {
+		terms := make([]float64, len(candidates[i]))
+		for l, c := range candidates[i] {
+			terms[l] = math.Log2(float64(c)) + bits[i+l+1]
+		}
+		top := slices.Max(terms)
+		sum := 0.0
+		for _, term := range terms {
+			sum += math.Exp2(term - top)
+		}
+		bits[i] = top + math.Log2(sum)
+	}
+	return bits[0]
+}
+
+func bigLog2(x *big.Int) float64 {
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(x).MantExp(mant)
+	m, _ := mant.Float64()
+	return math.Log2(m) + float64(exp)
+}
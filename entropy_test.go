@@ -0,0 +1,80 @@
+package whcypher
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTrie_Entropy(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcab")
+
+	// "ab" is a run at columns 0 and 3, "a" at 0 and 3 and "b" at 1 and 4,
+	// giving 2 codes as one run plus 2*2 as two runs.
+	report, err := trie.Entropy("ab", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !report.Exact || report.Encodings.Int64() != 6 {
+		t.Errorf("Expected exactly 6 encodings, got %v (exact %v)", report.Encodings, report.Exact)
+	}
+	if math.Abs(report.Bits-math.Log2(6)) > 1e-9 {
+		t.Errorf("Expected %f bits, got %f", math.Log2(6), report.Bits)
+	}
+	for _, p := range report.Positions {
+		if p.Choices != 4 {
+			t.Errorf("Expected 4 choices at %d, got %d", p.Index, p.Choices)
+		}
+	}
+
+	if _, err := trie.Entropy("abd", DirectionRight); err == nil {
+		t.Error("Expected letter not found error, got nil")
+	}
+	if _, err := trie.Entropy("", DirectionRight); err == nil {
+		t.Error("Expected invalid phrase error, got nil")
+	}
+}
+
+func TestTrie_Entropy_Weakest(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "aaaab")
+
+	report, err := trie.Entropy("ab", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	weakest := report.Weakest(1)
+	if len(weakest) != 1 || weakest[0].Letter != 'b' {
+		t.Errorf("Expected b to be weakest, got %v", weakest)
+	}
+	if weakest := report.Weakest(-1); len(weakest) != 0 {
+		t.Errorf("Expected no positions for a negative count, got %v", weakest)
+	}
+}
+
+func TestTrie_Entropy_Estimate(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcabcabc")
+
+	phrase := strings.Repeat("abc", 100)
+	exact, err := trie.Entropy(phrase, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	long, err := trie.Entropy(strings.Repeat(phrase, 2), DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if long.Exact || long.Encodings != nil {
+		t.Errorf("Expected an estimate for a long phrase, got %v", long.Encodings)
+	}
+
+	// Doubling the phrase roughly doubles the bits.
+	if math.Abs(long.Bits-2*exact.Bits) > 0.01*long.Bits {
+		t.Errorf("Expected about %f bits, got %f", 2*exact.Bits, long.Bits)
+	}
+	if est := estimateEncodingBits([][]int{{2, 2}, {2}}); math.Abs(est-math.Log2(6)) > 1e-9 {
+		t.Errorf("Expected estimate %f, got %f", math.Log2(6), est)
+	}
+}
@@ -0,0 +1,118 @@
+package whcypher
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+var (
+	// ErrEmptyPhrase is returned when a phrase has no letters to encode.
+	ErrEmptyPhrase = errors.New("invalid phrase: no letters")
+	// ErrNoDirection is returned when a search enables no directions.
+	ErrNoDirection = errors.New("no directions enabled")
+	// ErrInvalidCharacter matches every InvalidCharacterError with
+	// errors.Is.
+	ErrInvalidCharacter = errors.New("invalid character")
+	// ErrDirectionNotBuilt matches every DirectionNotBuiltError with
+	// errors.Is.
+	ErrDirectionNotBuilt = errors.New("direction not built")
+	// ErrSearchLimit is returned when the search for a code meeting the
+	// EncodeOptions constraints gives up before finding one or ruling it
+	// out.
+	ErrSearchLimit = errors.New("search limit reached")
+)
+
+// InvalidCharacterError reports a character that is not in the trie's
+// alphabet.
+type InvalidCharacterError struct {
+	// Pos is the index of the character in the phrase or row, counted in
+	// runes from 0.
+	Pos  int
+	Rune rune
+}
+
+func (e *InvalidCharacterError) Error() string {
+	return fmt.Sprintf("invalid character %q at position %d", e.Rune, e.Pos)
+}
+
+// Is reports whether target is ErrInvalidCharacter.
+func (e *InvalidCharacterError) Is(target error) bool {
+	return target == ErrInvalidCharacter
+}
+
+// DirectionNotBuiltError reports a search in directions the trie was not
+// built for.
+type DirectionNotBuiltError struct {
+	// Missing holds the requested directions that were not built.
+	Missing Direction
+	// Built holds the directions that were.
+	Built Direction
+}
+
+func (e *DirectionNotBuiltError) Error() string {
+	if e.Built == 0 {
+		return fmt.Sprintf("direction %s not built, the trie is empty", e.Missing)
+	}
+	return fmt.Sprintf("direction %s not built, the trie has %s", e.Missing, e.Built)
+}
+
+// Is reports whether target is ErrDirectionNotBuilt.
+func (e *DirectionNotBuiltError) Is(target error) bool {
+	return target == ErrDirectionNotBuilt
+}
+
+// CheckDirections returns a DirectionNotBuiltError unless every direction
+// in dir has been built. The encode methods, Search and FindLongestRun check
+// this themselves, while the deprecated SearchLetters and FindLongest need it
+// called first.
+func (t *Trie) CheckDirections(dir Direction) error {
+	built := t.Directions()
+	if missing := dir & DirectionAll &^ built; missing != 0 {
+		return &DirectionNotBuiltError{Missing: missing, Built: built}
+	}
+	return nil
+}
+
+// ValidatePhrase checks that every character of the phrase, other than white
+// space, is in the trie's alphabet.
+func (t *Trie) ValidatePhrase(phrase string) error {
+	_, err := t.preparePhrase(phrase)
+	return err
+}
+
+// preparePhrase returns the letters of the phrase looked up in the trie,
+// failing on characters outside the alphabet.
+func (t *Trie) preparePhrase(phrase string) ([]rune, error) {
+	letters := make([]rune, 0, len(phrase))
+	pos := 0
+	for _, r := range phrase {
+		if _, ok := t.alphabet.Index(r); ok {
+			letters = append(letters, unicode.ToLower(r))
+		} else if !unicode.IsSpace(r) {
+			return nil, &InvalidCharacterError{Pos: pos, Rune: r}
+		}
+		pos++
+	}
+	if len(letters) == 0 {
+		return nil, ErrEmptyPhrase
+	}
+	return letters, nil
+}
+
+// preparePhraseDir is preparePhrase that first checks dir can be searched.
+func (t *Trie) preparePhraseDir(phrase string, dir Direction) ([]rune, error) {
+	if err := t.checkSearch(dir); err != nil {
+		return nil, err
+	}
+	return t.preparePhrase(phrase)
+}
+
+// checkSearch checks dir enables a direction and every one of them has been
+// built.
+func (t *Trie) checkSearch(dir Direction) error {
+	if dir&DirectionAll == 0 {
+		return ErrNoDirection
+	}
+	return t.CheckDirections(dir)
+}
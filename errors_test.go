@@ -0,0 +1,168 @@
+package whcypher
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTrie_InvalidInput(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "hello")
+	trie.InsertPageRow(DirectionRight, 0, 1, "world")
+
+	encoders := map[string]func(phrase string, dir Direction) error{
+		"LTR": func(phrase string, dir Direction) error {
+			_, err := trie.ConstructPhraseLTR(phrase, dir)
+			return err
+		},
+		"Longest": func(phrase string, dir Direction) error {
+			_, err := trie.ConstructPhraseLongest(phrase, dir)
+			return err
+		},
+		"Optimal": func(phrase string, dir Direction) error {
+			_, err := trie.ConstructPhraseOptimal(phrase, dir)
+			return err
+		},
+		"Constrained": func(phrase string, dir Direction) error {
+			_, err := trie.Encode(phrase, dir, EncodeOptions{NoReuse: true})
+			return err
+		},
+		"Entropy": func(phrase string, dir Direction) error {
+			_, err := trie.Entropy(phrase, dir)
+			return err
+		},
+		"Alternatives": func(phrase string, dir Direction) error {
+			_, err := trie.EncodeAlternatives(phrase, dir, 2, EncodeOptions{})
+			return err
+		},
+	}
+
+	testCases := []struct {
+		description string
+		phrase      string
+		dir         Direction
+		expectedErr error
+		expectedPos int
+		expectedR   rune
+	}{
+		{
+			description: "Punctuation",
+			phrase:      "hello, world",
+			dir:         DirectionRight,
+			expectedErr: ErrInvalidCharacter,
+			expectedPos: 5,
+			expectedR:   ',',
+		},
+		{
+			description: "Letter outside the alphabet",
+			phrase:      "hé1",
+			dir:         DirectionRight,
+			expectedErr: ErrInvalidCharacter,
+			expectedPos: 1,
+			expectedR:   'é',
+		},
+		{
+			description: "Empty",
+			phrase:      "",
+			dir:         DirectionRight,
+			expectedErr: ErrEmptyPhrase,
+		},
+		{
+			description: "Only white space",
+			phrase:      " \t ",
+			dir:         DirectionRight,
+			expectedErr: ErrEmptyPhrase,
+		},
+		{
+			description: "No direction",
+			phrase:      "hello",
+			dir:         0,
+			expectedErr: ErrNoDirection,
+		},
+		{
+			description: "Direction not built",
+			phrase:      "hello",
+			dir:         DirectionRight | DirectionDown,
+			expectedErr: ErrDirectionNotBuilt,
+		},
+	}
+
+	for _, tc := range testCases {
+		for name, encode := range encoders {
+			t.Run(tc.description+"/"+name, func(t *testing.T) {
+				err := encode(tc.phrase, tc.dir)
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+				}
+				var charErr *InvalidCharacterError
+				if !errors.As(err, &charErr) {
+					return
+				}
+				if charErr.Pos != tc.expectedPos || charErr.Rune != tc.expectedR {
+					t.Errorf("Expected %q at %d, got %q at %d", tc.expectedR, tc.expectedPos, charErr.Rune, charErr.Pos)
+				}
+			})
+		}
+	}
+}
+
+func TestTrie_Search_DirectionNotBuilt(t *testing.T) {
+	trie, err := NewTrieFromSource(Source{{[]rune("hello")}}, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// SearchLetters and FindLongest find nothing in a direction that was
+	// not built, which Search, FindLongestRun and CheckDirections report.
+	if n, locs := trie.SearchLetters("olleh", DirectionLeft); n != 0 || len(locs) != 0 {
+		t.Errorf("Expected nothing found, got %d letters at %v", n, locs)
+	}
+	if _, size, locs := trie.FindLongest("olleh", DirectionLeft); size != 0 || len(locs) != 0 {
+		t.Errorf("Expected nothing found, got %d letters at %v", size, locs)
+	}
+	if _, _, err := trie.Search("olleh", DirectionLeft); !errors.Is(err, ErrDirectionNotBuilt) {
+		t.Errorf("Expected %v, got %v", ErrDirectionNotBuilt, err)
+	}
+	if _, _, _, err := trie.FindLongestRun("olleh", DirectionRight|DirectionLeft); !errors.Is(err, ErrDirectionNotBuilt) {
+		t.Errorf("Expected %v, got %v", ErrDirectionNotBuilt, err)
+	}
+	if _, _, err := trie.Search("olleh", 0); !errors.Is(err, ErrNoDirection) {
+		t.Errorf("Expected %v, got %v", ErrNoDirection, err)
+	}
+	if n, _, err := trie.Search("hel", DirectionRight); err != nil || n != 3 {
+		t.Errorf("Expected 3 letters found, got %d and %v", n, err)
+	}
+	if _, size, _, err := trie.FindLongestRun("xhel", DirectionRight); err != nil || size != 3 {
+		t.Errorf("Expected 3 letters found, got %d and %v", size, err)
+	}
+	if err := trie.CheckDirections(DirectionLeft); !errors.Is(err, ErrDirectionNotBuilt) {
+		t.Errorf("Expected %v, got %v", ErrDirectionNotBuilt, err)
+	}
+	if err := trie.CheckDirections(DirectionRight); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestTrie_ValidatePhrase(t *testing.T) {
+	trie := NewTrie()
+	if err := trie.ValidatePhrase("Hello World"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := trie.ValidatePhrase("grid 7"); !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Expected invalid character error, got %v", err)
+	}
+}
+
+func TestTrie_InsertSource_InvalidCharacter(t *testing.T) {
+	err := NewTrie().InsertSource(Source{{[]rune("abc"), []rune("d-f")}}, DirectionRight)
+	var charErr *InvalidCharacterError
+	if !errors.As(err, &charErr) {
+		t.Fatalf("Expected invalid character error, got %v", err)
+	}
+	if charErr.Pos != 1 || charErr.Rune != '-' {
+		t.Errorf("Expected '-' at 1, got %q at %d", charErr.Rune, charErr.Pos)
+	}
+	if err := NewTrie().InsertPagePart(DirectionRight, 0, 0, 0, "ab!"); !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Expected invalid character error, got %v", err)
+	}
+}
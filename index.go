@@ -0,0 +1,652 @@
+package whcypher
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"slices"
+)
+
+// indexMagic starts every saved index.
+const indexMagic = "WHCI"
+
+// IndexVersion is the version of the saved index format written by
+// WriteIndex. Tries saved by versions 1, which can not hold wrapped runs,
+// and 2 are still read. Suffix indexes of version 2, which saved the text of
+// every direction, and indexes of other versions are rejected.
+const IndexVersion = 3
+
+const (
+	indexKindTrie   byte = 1
+	indexKindSuffix byte = 2
+)
+
+// indexWrap is set in the flags of an index holding wrapped runs, which are
+// followed by the size of every page.
+const indexWrap byte = 1
+
+var (
+	// ErrStaleIndex is returned when a saved index was built from a
+	// different source.
+	ErrStaleIndex = errors.New("index was built from a different source")
+	// ErrIndexVersion is returned when a saved index has an unsupported
+	// format version.
+	ErrIndexVersion = errors.New("unsupported index version")
+)
+
+// IndexHeader describes a saved index.
+type IndexHeader struct {
+	Version int
+	// Directions are the directions the index was built for.
+	Directions Direction
+	// Alphabet is the letters of the index.
+	Alphabet string
+	// Checksum is SourceChecksum of the source the index was built from.
+	Checksum [sha256.Size]byte
+	// SourceName names the source, such as its absolute file path, so it
+	// can be found again to check the index.
+	SourceName string
+	// Wrap is set when the index holds runs that wrap around the page
+	// edges.
+	Wrap bool
+}
+
+// Check returns ErrStaleIndex unless the index was built from the source.
+func (h *IndexHeader) Check(source Source) error {
+	if SourceChecksum(source) != h.Checksum {
+		return ErrStaleIndex
+	}
+	return nil
+}
+
+// SourceChecksum returns the SHA-256 of the source's pages and rows, so
+// sources that differ only in line endings or extra blank lines match.
+func SourceChecksum(source Source) [sha256.Size]byte {
+	h := sha256.New()
+	for _, page := range source {
+		for _, row := range page {
+			io.WriteString(h, string(row))
+			h.Write([]byte{'\n'})
+		}
+		h.Write([]byte{'\n'})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// WriteIndex saves the trie, which must have been built from the source, so
+// ReadIndex can load it without building it again. name is stored in the
+// header to describe the source. A trie searching a suffix index saves the
+// suffix index, which is far smaller.
+func (t *Trie) WriteIndex(w io.Writer, source Source, name string) error {
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	iw := &indexWriter{w: bw}
+
+	iw.bytes([]byte(indexMagic))
+	iw.uvarint(IndexVersion)
+	if t.index != nil {
+		iw.bytes([]byte{indexKindSuffix, byte(t.index.built)})
+	} else {
+		iw.bytes([]byte{indexKindTrie, byte(t.built)})
+	}
+	checksum := SourceChecksum(source)
+	iw.bytes(checksum[:])
+	iw.string(t.alphabet.String())
+	iw.string(name)
+	if t.wrap {
+		iw.bytes([]byte{indexWrap})
+		iw.uvarint(len(t.sizes))
+		for _, size := range t.sizes {
+			iw.uvarint(size[0])
+			iw.uvarint(size[1])
+		}
+	} else {
+		iw.bytes([]byte{0})
+	}
+	if t.index != nil {
+		iw.suffixIndex(t.index, source)
+	} else {
+		iw.node(t.RootNode)
+	}
+	if iw.err != nil {
+		return iw.err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+// ReadIndex loads a trie saved by WriteIndex.
+func ReadIndex(r io.Reader) (*Trie, *IndexHeader, error) {
+	ir := &indexReader{r: &crcReader{r: r, buf: make([]byte, 1<<16)}}
+
+	if magic := ir.bytes(len(indexMagic)); ir.err == nil && string(magic) != indexMagic {
+		return nil, nil, errors.New("not a saved index")
+	}
+	h := &IndexHeader{Version: int(ir.uvarint())}
+	if ir.err == nil && (h.Version < 1 || h.Version > IndexVersion) {
+		return nil, nil, fmt.Errorf("%w: %d", ErrIndexVersion, h.Version)
+	}
+	kind := ir.bytes(2)
+	if ir.err == nil && kind[0] != indexKindTrie && kind[0] != indexKindSuffix {
+		return nil, nil, fmt.Errorf("unsupported index kind: %d", kind[0])
+	}
+	copy(h.Checksum[:], ir.bytes(sha256.Size))
+	h.Alphabet = ir.string()
+	h.SourceName = ir.string()
+	var sizes [][2]int
+	if h.Version > 1 {
+		flags := ir.byte()
+		if ir.err == nil && flags&^indexWrap != 0 {
+			return nil, nil, fmt.Errorf("unsupported index flags: %d", flags)
+		}
+		h.Wrap = flags&indexWrap != 0
+		if h.Wrap {
+			sizes = ir.pageSizes()
+		}
+	}
+	if ir.err != nil {
+		return nil, nil, fmt.Errorf("reading index header: %w", ir.err)
+	}
+	h.Directions = Direction(kind[1])
+	if kind[0] == indexKindSuffix && h.Version != IndexVersion {
+		return nil, nil, fmt.Errorf("%w: %d suffix index", ErrIndexVersion, h.Version)
+	}
+
+	alphabet, err := NewAlphabet(h.Alphabet)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading index header: %w", err)
+	}
+	var t *Trie
+	if kind[0] == indexKindSuffix {
+		source := ir.source()
+		if ir.err == nil && SourceChecksum(source) != h.Checksum {
+			ir.err = errors.New("saved source does not match its checksum")
+		}
+		x := ir.suffixIndex(source, alphabet, h.Directions, sizes)
+		if ir.err != nil {
+			return nil, nil, fmt.Errorf("reading index: %w", ir.err)
+		}
+		t = NewTrieWithIndex(x)
+	} else {
+		t = NewTrieWithAlphabet(alphabet)
+		t.built = h.Directions
+		t.wrap, t.sizes = h.Wrap, sizes
+		t.RootNode = ir.node(alphabet.Len(), h.Directions&DirectionAll, 0)
+		if ir.err != nil {
+			return nil, nil, fmt.Errorf("reading index: %w", ir.err)
+		}
+	}
+
+	// The sum is taken before the checksum is read so it is not part of
+	// it.
+	crc := ir.r.sum()
+	var trailer [4]byte
+	if _, err := io.ReadFull(ir.r, trailer[:]); err != nil {
+		return nil, nil, fmt.Errorf("reading index checksum: %w", err)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != crc {
+		return nil, nil, errors.New("index is corrupt: checksum mismatch")
+	}
+	return t, h, nil
+}
+
+// indexWriter writes index fields, keeping the first error.
+type indexWriter struct {
+	w   *bufio.Writer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (iw *indexWriter) bytes(b []byte) {
+	if iw.err == nil {
+		_, iw.err = iw.w.Write(b)
+	}
+}
+
+func (iw *indexWriter) uvarint(v int) {
+	iw.bytes(binary.AppendUvarint(iw.buf[:0], uint64(v)))
+}
+
+func (iw *indexWriter) string(s string) {
+	iw.uvarint(len(s))
+	iw.bytes([]byte(s))
+}
+
+// node writes the node's directions, its locations for each of them and
+// then its children, each after its index in the alphabet.
+func (iw *indexWriter) node(n *Node) {
+	iw.bytes([]byte{byte(n.LocDirections)})
+	dirs := make([]Direction, 0, len(n.KnownLoc))
+	for d := range n.KnownLoc {
+		dirs = append(dirs, d)
+	}
+	slices.Sort(dirs)
+	iw.uvarint(len(dirs))
+	for _, d := range dirs {
+		locs := n.KnownLoc[d]
+		iw.bytes([]byte{byte(d)})
+		iw.uvarint(len(locs))
+		for _, l := range locs {
+			for _, v := range l {
+				iw.uvarint(v)
+			}
+		}
+	}
+
+	children := 0
+	for _, c := range n.Children {
+		if c != nil {
+			children++
+		}
+	}
+	iw.uvarint(children)
+	for i, c := range n.Children {
+		if c != nil {
+			iw.uvarint(i)
+			iw.node(c)
+		}
+	}
+}
+
+// suffixIndex writes the source once and then the sorted suffixes of each
+// array after its direction. Everything else in the arrays is laid out from
+// the source again when the index is read.
+func (iw *indexWriter) suffixIndex(x *SuffixIndex, source Source) {
+	iw.uvarint(len(source))
+	for _, page := range source {
+		iw.uvarint(len(page))
+		for _, row := range page {
+			iw.string(string(row))
+		}
+	}
+
+	dirs := x.built.Directions()
+	iw.uvarint(len(dirs))
+	for _, d := range dirs {
+		a := x.arrays[d]
+		iw.bytes([]byte{byte(d)})
+		iw.uvarint(len(a.suffixes))
+		iw.packed(a.suffixes, len(a.text))
+	}
+}
+
+// packed writes values from 0 to limit in as few bits as limit needs.
+func (iw *indexWriter) packed(values []int32, limit int) {
+	width := bits.Len(uint(limit))
+	b := make([]byte, 0, (len(values)*width+7)/8)
+	var acc uint64
+	n := 0
+	for _, v := range values {
+		acc |= uint64(v) & (1<<width - 1) << n
+		for n += width; n >= 8; n -= 8 {
+			b = append(b, byte(acc))
+			acc >>= 8
+		}
+	}
+	if n > 0 {
+		b = append(b, byte(acc))
+	}
+	iw.bytes(b)
+}
+
+// crcReader buffers its reader and keeps the CRC-32 of the bytes read
+// through it. Bytes are summed a buffer at a time rather than as each is
+// read.
+type crcReader struct {
+	r   io.Reader
+	buf []byte
+	// pos and end bound the unread bytes of buf, and summed is where the
+	// bytes not yet in crc start.
+	pos, end, summed int
+	crc              uint32
+	err              error
+}
+
+// fill sums the bytes read so far and reads more into buf.
+func (c *crcReader) fill() error {
+	c.sum()
+	for c.pos == c.end && c.err == nil {
+		c.end, c.err = c.r.Read(c.buf)
+		c.pos, c.summed = 0, 0
+	}
+	if c.pos < c.end {
+		return nil
+	}
+	return c.err
+}
+
+// sum returns the CRC-32 of every byte read.
+func (c *crcReader) sum() uint32 {
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, c.buf[c.summed:c.pos])
+	c.summed = c.pos
+	return c.crc
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	if c.pos == c.end {
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf[c.pos:c.end])
+	c.pos += n
+	return n, nil
+}
+
+func (c *crcReader) ReadByte() (byte, error) {
+	if c.pos == c.end {
+		if err := c.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := c.buf[c.pos]
+	c.pos++
+	return b, nil
+}
+
+// indexReader reads index fields, keeping the first error.
+type indexReader struct {
+	r   *crcReader
+	err error
+
+	// Nodes, their children and locations are cut from these blocks
+	// rather than allocated one by one, as a trie has millions of them.
+	nodes    slab[Node]
+	children slab[*Node]
+	locs     slab[[4]int]
+}
+
+// slab hands out slices of a block, allocating a new block when it runs out.
+type slab[T any] struct {
+	block []T
+}
+
+// slabSize is the number of values in each block.
+const slabSize = 1 << 12
+
+// take returns n zero values, which must be at most slabSize. Appending to
+// them never overwrites the rest of the block.
+func (s *slab[T]) take(n int) []T {
+	if len(s.block) < n {
+		s.block = make([]T, slabSize)
+	}
+	out := s.block[:n:n]
+	s.block = s.block[n:]
+	return out
+}
+
+func (ir *indexReader) bytes(n int) []byte {
+	b := make([]byte, n)
+	if ir.err == nil {
+		_, ir.err = io.ReadFull(ir.r, b)
+	}
+	return b
+}
+
+func (ir *indexReader) byte() byte {
+	if ir.err != nil {
+		return 0
+	}
+	b, err := ir.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	ir.err = err
+	return b
+}
+
+func (ir *indexReader) uvarint() int {
+	if ir.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(ir.r)
+	if err != nil {
+		ir.err = err
+		return 0
+	}
+	if v > 1<<31 {
+		ir.err = fmt.Errorf("value out of range: %d", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (ir *indexReader) string() string {
+	n := ir.uvarint()
+	if n > 1<<16 {
+		ir.err = fmt.Errorf("string too long: %d", n)
+	}
+	if ir.err != nil {
+		return ""
+	}
+	return string(ir.bytes(n))
+}
+
+// maxIndexDepth bounds how deep the nodes of a saved trie may nest, well
+// above the longest run of any real source.
+const maxIndexDepth = 1 << 16
+
+// node reads a node written by indexWriter.node at depth letters below the
+// root, checking that every direction it holds was built and has locations
+// of that many letters.
+func (ir *indexReader) node(letters int, built Direction, depth int) *Node {
+	if depth > maxIndexDepth {
+		ir.err = fmt.Errorf("trie too deep: %d", depth)
+		return NewNode()
+	}
+	n := &ir.nodes.take(1)[0]
+	n.LocDirections = Direction(ir.byte())
+	dirs := ir.uvarint()
+	if dirs > 0 {
+		n.KnownLoc = make(map[Direction][][4]int, min(dirs, 8))
+	}
+	var located Direction
+	for i := 0; i < dirs && ir.err == nil; i++ {
+		d := Direction(ir.byte())
+		if _, _, ok := d.Delta(); !ok || d&built == 0 {
+			ir.err = fmt.Errorf("invalid trie location direction: %d", d)
+			break
+		}
+		count := ir.uvarint()
+		var locs [][4]int
+		if count <= slabSize {
+			locs = ir.locs.take(count)[:0]
+		} else {
+			locs = make([][4]int, 0, min(count, 1<<16))
+		}
+		for j := 0; j < count && ir.err == nil; j++ {
+			l := [4]int{ir.uvarint(), ir.uvarint(), ir.uvarint(), ir.uvarint()}
+			if ir.err == nil && l[3] != depth {
+				ir.err = fmt.Errorf("trie location length %d at depth %d", l[3], depth)
+			}
+			locs = append(locs, l)
+		}
+		n.KnownLoc[d] = locs
+		if len(locs) > 0 {
+			located |= d
+		}
+	}
+	if ir.err != nil {
+		return n
+	}
+	if n.LocDirections&^built != 0 {
+		ir.err = fmt.Errorf("invalid trie node directions: %d", n.LocDirections)
+		return n
+	}
+	if missing := n.LocDirections &^ located; missing != 0 {
+		ir.err = fmt.Errorf("trie node has no locations for %s", missing)
+		return n
+	}
+
+	children := ir.uvarint()
+	if children > 0 && ir.err == nil {
+		if letters <= slabSize {
+			n.Children = ir.children.take(letters)
+		} else {
+			n.Children = make([]*Node, letters)
+		}
+	}
+	for i := 0; i < children && ir.err == nil; i++ {
+		index := ir.uvarint()
+		if index >= letters {
+			ir.err = fmt.Errorf("letter out of range: %d", index)
+			break
+		}
+		n.Children[index] = ir.node(letters, built, depth+1)
+	}
+	return n
+}
+
+// pageSizes reads the rows and columns of every page of a wrapped index.
+func (ir *indexReader) pageSizes() [][2]int {
+	n := ir.uvarint()
+	sizes := make([][2]int, 0, min(n, 1<<16))
+	for i := 0; i < n && ir.err == nil; i++ {
+		sizes = append(sizes, [2]int{ir.uvarint(), ir.uvarint()})
+	}
+	return sizes
+}
+
+// source reads the source written by indexWriter.suffixIndex.
+func (ir *indexReader) source() Source {
+	pages := ir.uvarint()
+	source := make(Source, 0, min(pages, 1<<16))
+	for i := 0; i < pages && ir.err == nil; i++ {
+		rows := ir.uvarint()
+		page := make([][]rune, 0, min(rows, 1<<16))
+		for j := 0; j < rows && ir.err == nil; j++ {
+			// Rows can be far longer than the strings of the header.
+			n := ir.uvarint()
+			page = append(page, []rune(string(ir.chunks(n, 1))))
+		}
+		source = append(source, page)
+	}
+	return source
+}
+
+// suffixIndex reads the suffixes written by indexWriter.suffixIndex, lays out
+// the rest of each array from the source and checks they can be searched
+// without going out of range. sizes is nil unless the runs wrap.
+func (ir *indexReader) suffixIndex(source Source, alphabet *Alphabet, built Direction, sizes [][2]int) *SuffixIndex {
+	x := &SuffixIndex{
+		alphabet: alphabet,
+		built:    built & DirectionAll,
+		arrays:   make(map[Direction]*suffixArray),
+		sizes:    sizes,
+	}
+	if ir.err != nil {
+		return x
+	}
+	t := &Trie{alphabet: alphabet}
+	if err := t.validateSource(source); err != nil {
+		ir.err = err
+		return x
+	}
+	if sizes != nil {
+		if want, err := pageSizes(source); err != nil || !slices.Equal(want, sizes) {
+			ir.err = errors.New("page sizes do not match the saved source")
+			return x
+		}
+	}
+
+	grid := newLetterGrid(source, alphabet)
+	dirs := ir.uvarint()
+	for i := 0; i < dirs && ir.err == nil; i++ {
+		d := Direction(ir.byte())
+		if _, _, ok := d.Delta(); ir.err == nil && (!ok || d&x.built == 0) {
+			ir.err = fmt.Errorf("invalid suffix array direction: %d", d)
+			break
+		}
+		a := x.layoutSuffixArray(grid, d)
+		if n := ir.uvarint(); ir.err == nil && n != len(a.suffixes) {
+			ir.err = errors.New("suffix array does not match the saved source")
+		}
+		laidOut := a.suffixes
+		a.suffixes = ir.packed(len(a.suffixes), len(a.text))
+		if ir.err != nil {
+			break
+		}
+		if sizes != nil {
+			// Positions that start no suffix end at 0, which check
+			// rejects.
+			ends := make([]int32, len(a.text))
+			for j, pos := range laidOut {
+				ends[pos] = a.ends[j]
+			}
+			for j, pos := range a.suffixes {
+				if int(pos) < len(ends) {
+					a.ends[j] = ends[pos]
+				} else {
+					a.ends[j] = 0
+				}
+			}
+		}
+		ir.err = a.checkSuffixes()
+		x.arrays[d] = a
+	}
+	if ir.err == nil && len(x.arrays) != len(x.built.Directions()) {
+		ir.err = errors.New("missing suffix arrays")
+	}
+	return x
+}
+
+// chunks reads n values of size bytes each, growing the buffer as data
+// arrives so a corrupt length can not allocate more than the input holds.
+func (ir *indexReader) chunks(n, size int) []byte {
+	const chunk = 1 << 20
+	b := []byte{}
+	for remaining := n * size; remaining > 0 && ir.err == nil; remaining -= chunk {
+		b = append(b, ir.bytes(min(remaining, chunk))...)
+	}
+	if ir.err != nil {
+		return nil
+	}
+	return b
+}
+
+// packed reads n values written by indexWriter.packed with the same limit.
+func (ir *indexReader) packed(n, limit int) []int32 {
+	width := bits.Len(uint(limit))
+	b := ir.chunks((n*width+7)/8, 1)
+	if ir.err != nil {
+		return nil
+	}
+	// Each value is read with one 8 byte load, which the padding keeps in
+	// range for the last values.
+	b = append(b, make([]byte, 8)...)
+	values := make([]int32, n)
+	for i := range values {
+		bit := i * width
+		v := binary.LittleEndian.Uint64(b[bit/8:]) >> (bit % 8)
+		values[i] = int32(v & (1<<width - 1))
+	}
+	return values
+}
+
+// checkSuffixes fails when a search of the array could index out of range.
+// Only the suffixes and their ends are read from the index; the rest of the
+// array is laid out from the source.
+func (a *suffixArray) checkSuffixes() error {
+	for _, pos := range a.suffixes {
+		if int(pos) >= len(a.text) || a.text[pos] == 0 {
+			return fmt.Errorf("suffix out of range: %d", pos)
+		}
+	}
+	for i, end := range a.ends {
+		if end <= a.suffixes[i] || int(end) > len(a.text) {
+			return fmt.Errorf("suffix end out of range: %d", end)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package whcypher
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrie_WriteIndex(t *testing.T) {
+	source := testSource(t, "abcabc\nbcabca\n")
+	dir := DirectionRight | DirectionDown | DirectionLeftUp
+	trie, err := NewTrieFromSource(source, dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := trie.WriteIndex(&buf, source, "random.txt"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loaded, header, err := ReadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var again bytes.Buffer
+	if err := loaded.WriteIndex(&again, source, "random.txt"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(again.Bytes(), buf.Bytes()) {
+		t.Error("Expected loaded trie to save the same index")
+	}
+	for _, term := range []string{"rmw", "ryl", "nob", "cab", "xyz"} {
+		expectedIndex, expectedLocs := trie.SearchLetters(term, dir)
+		index, locs := loaded.SearchLetters(term, dir)
+		if index != expectedIndex {
+			t.Errorf("Expected %q to match %d letters, got %d", term, expectedIndex, index)
+		}
+		if diff := cmp.Diff(locs, expectedLocs); diff != "" {
+			t.Errorf("Expected %q locations to match, got diff (-got,+want) %s", term, diff)
+		}
+	}
+	if loaded.Directions() != dir || header.Directions != dir {
+		t.Errorf("Expected directions %v, got %v and %v", dir, loaded.Directions(), header.Directions)
+	}
+	if header.SourceName != "random.txt" || header.Version != IndexVersion {
+		t.Errorf("Expected random.txt version %d, got %s version %d", IndexVersion, header.SourceName, header.Version)
+	}
+	if err := header.Check(source); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// Tries are saved the same way since version 2, so one saved then
+	// still loads.
+	v2 := bytes.Clone(buf.Bytes())
+	v2[len(indexMagic)] = 2
+	v2 = binary.BigEndian.AppendUint32(v2[:len(v2)-4], crc32.ChecksumIEEE(v2[:len(v2)-4]))
+	v2Trie, v2Header, err := ReadIndex(bytes.NewReader(v2))
+	if err != nil {
+		t.Fatalf("Expected version 2 trie to load, got %v", err)
+	}
+	if v2Header.Version != 2 {
+		t.Errorf("Expected version 2, got %d", v2Header.Version)
+	}
+	if index, locs := v2Trie.SearchLetters("rmw", dir); index != 3 || len(locs) == 0 {
+		t.Errorf("Expected rmw found in version 2 trie, got %d letters at %v", index, locs)
+	}
+
+	changed, _ := ParseSource(strings.NewReader("abcabc\nbcabcb\n"))
+	if err := header.Check(changed); !errors.Is(err, ErrStaleIndex) {
+		t.Errorf("Expected stale index error, got %v", err)
+	}
+}
+
+func TestReadIndex_Invalid(t *testing.T) {
+	source := Source{{[]rune("abc")}}
+	trie, err := NewTrieFromSource(source, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var buf bytes.Buffer
+	if err := trie.WriteIndex(&buf, source, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	saved := buf.Bytes()
+
+	testCases := []struct {
+		description string
+		data        func() []byte
+	}{
+		{
+			description: "Empty",
+			data:        func() []byte { return nil },
+		},
+		{
+			description: "Not an index",
+			data:        func() []byte { return []byte("abc\ndef\n") },
+		},
+		{
+			description: "Other version",
+			data: func() []byte {
+				b := bytes.Clone(saved)
+				b[len(indexMagic)] = IndexVersion + 1
+				return b
+			},
+		},
+		{
+			description: "Truncated",
+			data:        func() []byte { return saved[:len(saved)-6] },
+		},
+		{
+			description: "Corrupt",
+			data: func() []byte {
+				b := bytes.Clone(saved)
+				b[len(b)-8] ^= 0x01
+				return b
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, _, err := ReadIndex(bytes.NewReader(tc.data())); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestReadIndex_InconsistentTrie(t *testing.T) {
+	source := Source{{[]rune("abc")}}
+
+	testCases := []struct {
+		description string
+		corrupt     func(trie *Trie)
+	}{
+		{
+			description: "Direction without locations",
+			corrupt: func(trie *Trie) {
+				delete(trie.RootNode.Child(0).KnownLoc, DirectionLeft)
+			},
+		},
+		{
+			description: "Direction not built",
+			corrupt: func(trie *Trie) {
+				trie.RootNode.Child(0).LocDirections |= DirectionDown
+			},
+		},
+		{
+			description: "Location direction not built",
+			corrupt: func(trie *Trie) {
+				trie.RootNode.Child(0).AddLoc(DirectionDown, 0, 0, 0, 1)
+			},
+		},
+		{
+			description: "Location in several directions",
+			corrupt: func(trie *Trie) {
+				trie.RootNode.Child(0).AddLoc(DirectionRight|DirectionLeft, 0, 0, 0, 1)
+			},
+		},
+		{
+			description: "Location length not its depth",
+			corrupt: func(trie *Trie) {
+				trie.RootNode.Child(0).KnownLoc[DirectionRight][0][3] = 2
+			},
+		},
+		{
+			description: "Too deep",
+			corrupt: func(trie *Trie) {
+				n := trie.RootNode.Child(0)
+				for i := 0; i < maxIndexDepth; i++ {
+					n.Children = make([]*Node, trie.Alphabet().Len())
+					n.Children[0] = NewNode()
+					n = n.Children[0]
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			trie, err := NewTrieFromSource(source, DirectionRight|DirectionLeft)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			tc.corrupt(trie)
+			var buf bytes.Buffer
+			if err := trie.WriteIndex(&buf, source, ""); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if _, _, err := ReadIndex(&buf); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTrie_WriteIndex_Suffix(t *testing.T) {
+	source := testSource(t, "abcabc\nbcabca\n")
+	index, err := NewSuffixIndex(source, DirectionAll, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie := NewTrieWithIndex(index)
+
+	var buf bytes.Buffer
+	if err := trie.WriteIndex(&buf, source, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loaded, header, err := ReadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if header.Directions != DirectionAll || loaded.Directions() != DirectionAll {
+		t.Errorf("Expected all directions, got %v and %v", header.Directions, loaded.Directions())
+	}
+
+	phrase := "the random letters are a mess"
+	expected, err := trie.EncodeOptimal(phrase, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := loaded.EncodeOptimal(phrase, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected loaded index to encode the same, got diff (-got,+want) %s", diff)
+	}
+	if diff := cmp.Diff(loaded.index.arrays, index.arrays, cmp.AllowUnexported(suffixArray{})); diff != "" {
+		t.Errorf("Expected loaded suffix arrays to match, got diff (-got,+want) %s", diff)
+	}
+
+	// Rows longer than the strings of the header are saved and read in
+	// full.
+	rng := rand.New(rand.NewSource(1))
+	row := make([]rune, 1<<16+1)
+	for i := range row {
+		row[i] = rune('a' + rng.Intn(26))
+	}
+	long := Source{{row}}
+	longIndex, err := NewSuffixIndex(long, DirectionRight, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var longBuf bytes.Buffer
+	if err := NewTrieWithIndex(longIndex).WriteIndex(&longBuf, long, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, err := ReadIndex(&longBuf); err != nil {
+		t.Errorf("Expected index of a long row to load, got %v", err)
+	}
+
+	// Suffix indexes of version 2 saved their arrays in full and must be
+	// rebuilt.
+	old := bytes.Clone(buf.Bytes())
+	old[len(indexMagic)] = 2
+	if _, _, err := ReadIndex(bytes.NewReader(old)); !errors.Is(err, ErrIndexVersion) {
+		t.Errorf("Expected version error, got %v", err)
+	}
+
+	// A suffix pointing past the text must be rejected rather than panic
+	// in a search, even with a valid checksum.
+	bad := loaded.index.arrays[DirectionRight]
+	bad.suffixes[0] = int32(len(bad.text))
+	buf.Reset()
+	if err := loaded.WriteIndex(&buf, source, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, err := ReadIndex(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("Expected out of range error, got nil")
+	}
+}
@@ -0,0 +1,233 @@
+package whcypher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const ledgerVersion = 1
+
+// lockTimeout is how long UpdateLedger waits for another process to release
+// the ledger, and lockStale how old a lock must be to be considered left
+// behind by a crashed process.
+const (
+	lockTimeout = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+// LedgerEntry records how often a location has been used in codes.
+type LedgerEntry struct {
+	Location Location  `json:"location"`
+	Count    int       `json:"count"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Ledger records every location used in codes sent from a source, so later
+// codes can avoid them. Locations are zero based like the ones returned by
+// Encode.
+type Ledger struct {
+	entries map[Location]*LedgerEntry
+}
+
+// NewLedger returns an empty ledger.
+func NewLedger() *Ledger {
+	return &Ledger{
+		entries: make(map[Location]*LedgerEntry),
+	}
+}
+
+// Record adds one use of every location at the given time.
+func (l *Ledger) Record(locs []Location, at time.Time) {
+	for _, loc := range locs {
+		e, ok := l.entries[loc]
+		if !ok {
+			e = &LedgerEntry{Location: loc}
+			l.entries[loc] = e
+		}
+		e.Count++
+		if at.After(e.LastUsed) {
+			e.LastUsed = at
+		}
+	}
+}
+
+// Count returns how often the location has been used.
+func (l *Ledger) Count(loc Location) int {
+	if l == nil {
+		return 0
+	}
+	if e, ok := l.entries[loc]; ok {
+		return e.Count
+	}
+	return 0
+}
+
+// Entries returns every recorded location, most used first.
+func (l *Ledger) Entries() []LedgerEntry {
+	entries := make([]LedgerEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, *e)
+	}
+	slices.SortFunc(entries, func(a, b LedgerEntry) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return compareLocations(a.Location, b.Location)
+	})
+	return entries
+}
+
+// Len returns the number of distinct locations recorded.
+func (l *Ledger) Len() int {
+	return len(l.entries)
+}
+
+// Reset removes every entry.
+func (l *Ledger) Reset() {
+	l.entries = make(map[Location]*LedgerEntry)
+}
+
+// Prune removes entries last used before the given time and returns how
+// many were removed.
+func (l *Ledger) Prune(before time.Time) int {
+	removed := 0
+	for loc, e := range l.entries {
+		if e.LastUsed.Before(before) {
+			delete(l.entries, loc)
+			removed++
+		}
+	}
+	return removed
+}
+
+type ledgerFile struct {
+	Version int           `json:"version"`
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// MarshalJSON encodes the ledger with a version so the file format can change.
+func (l *Ledger) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ledgerFile{Version: ledgerVersion, Entries: l.Entries()})
+}
+
+// UnmarshalJSON decodes a ledger written by MarshalJSON.
+func (l *Ledger) UnmarshalJSON(data []byte) error {
+	var f ledgerFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f.Version != ledgerVersion {
+		return fmt.Errorf("unsupported ledger version: %d", f.Version)
+	}
+
+	l.entries = make(map[Location]*LedgerEntry, len(f.Entries))
+	for _, e := range f.Entries {
+		e := e
+		l.entries[e.Location] = &e
+	}
+	return nil
+}
+
+// LoadLedger reads a ledger file. A missing file is an empty ledger.
+func LoadLedger(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewLedger(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l := NewLedger()
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid ledger %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Save writes the ledger to a temporary file and renames it over path, so
+// readers never see a partially written ledger.
+func (l *Ledger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// UpdateLedger loads the ledger at path, applies update and saves it while
+// holding a lock file, so concurrent updates are not lost.
+func UpdateLedger(path string, update func(*Ledger) error) error {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	l, err := LoadLedger(path)
+	if err != nil {
+		return err
+	}
+	if err := update(l); err != nil {
+		return err
+	}
+	return l.Save(path)
+}
+
+// lockFile creates the lock file, waiting for any other holder to remove it.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for lock: " + path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func compareLocations(a, b Location) int {
+	ra, rb := a.Raw(), b.Raw()
+	for i := range ra {
+		if d := ra[i] - rb[i]; d != 0 {
+			return d
+		}
+	}
+	return 0
+}
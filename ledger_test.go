@@ -0,0 +1,153 @@
+package whcypher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLedger_Record(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	a := Location{Page: 0, Row: 1, Col: 2, Len: 3, Dir: DirectionRight}
+	b := Location{Page: 1, Row: 1, Col: 1, Len: 1, Dir: DirectionUp}
+
+	ledger := NewLedger()
+	ledger.Record([]Location{a, b, a}, now)
+	if ledger.Count(a) != 2 {
+		t.Errorf("Expected count 2, got %d", ledger.Count(a))
+	}
+	if ledger.Count(b) != 1 {
+		t.Errorf("Expected count 1, got %d", ledger.Count(b))
+	}
+	if ledger.Count(Location{}) != 0 {
+		t.Errorf("Expected count 0, got %d", ledger.Count(Location{}))
+	}
+
+	expected := []LedgerEntry{{Location: a, Count: 2, LastUsed: now}, {Location: b, Count: 1, LastUsed: now}}
+	if diff := cmp.Diff(ledger.Entries(), expected); diff != "" {
+		t.Errorf("Expected entries to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestLedger_Prune(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(48 * time.Hour)
+	a := Location{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}
+	b := Location{Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight}
+
+	ledger := NewLedger()
+	ledger.Record([]Location{a}, old)
+	ledger.Record([]Location{b}, recent)
+	if removed := ledger.Prune(old.Add(time.Hour)); removed != 1 {
+		t.Errorf("Expected 1 removed, got %d", removed)
+	}
+	if ledger.Count(a) != 0 || ledger.Count(b) != 1 {
+		t.Errorf("Expected only the recent entry, got %v", ledger.Entries())
+	}
+
+	ledger.Reset()
+	if ledger.Len() != 0 {
+		t.Errorf("Expected empty ledger, got %d entries", ledger.Len())
+	}
+}
+
+func TestLedger_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	empty, err := LoadLedger(path)
+	if err != nil {
+		t.Fatalf("Expected no error for missing ledger, got %v", err)
+	}
+	if empty.Len() != 0 {
+		t.Errorf("Expected empty ledger, got %d entries", empty.Len())
+	}
+
+	ledger := NewLedger()
+	ledger.Record([]Location{{Page: 2, Row: 3, Col: 4, Len: 5, Dir: DirectionLeftDown}}, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err := ledger.Save(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	loaded, err := LoadLedger(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(loaded.Entries(), ledger.Entries()); diff != "" {
+		t.Errorf("Expected entries to match, got diff (-got,+want) %s", diff)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version":99}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLedger(path); err == nil {
+		t.Error("Expected unsupported version error, got nil")
+	}
+}
+
+func TestUpdateLedger_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	loc := Location{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := UpdateLedger(path, func(l *Ledger) error {
+				l.Record([]Location{loc}, time.Now())
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ledger, err := LoadLedger(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ledger.Count(loc) != 10 {
+		t.Errorf("Expected count 10, got %d", ledger.Count(loc))
+	}
+}
+
+func TestTrie_Encode_Ledger(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcab")
+
+	ledger := NewLedger()
+	ledger.Record([]Location{{Page: 0, Row: 0, Col: 0, Len: 2, Dir: DirectionRight}}, time.Now())
+
+	result, err := trie.Encode("ab", DirectionRight, EncodeOptions{Ledger: ledger})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(result, []Location{{Page: 0, Row: 0, Col: 3, Len: 2, Dir: DirectionRight}}); diff != "" {
+		t.Errorf("Expected unused location, got diff (-got,+want) %s", diff)
+	}
+
+	// Down-weighted locations are still used once nothing else is left.
+	ledger.Record(result, time.Now())
+	result, err = trie.Encode("ab", DirectionRight, EncodeOptions{Ledger: ledger})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result) != 1 || result[0].Len != 2 {
+		t.Errorf("Expected a used location, got %v", result)
+	}
+
+	// Avoided locations fall back to shorter runs.
+	result, err = trie.Encode("ab", DirectionRight, EncodeOptions{Ledger: ledger, AvoidLedger: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(result, []Location{{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight}}); diff != "" {
+		t.Errorf("Expected shorter runs, got diff (-got,+want) %s", diff)
+	}
+}
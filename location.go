@@ -0,0 +1,222 @@
+package whcypher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WrapBit is set in the direction of a [page, row, col, len, direction]
+// tuple whose run wraps around the edge of its page.
+const WrapBit = 1 << 8
+
+// Location is a single run of letters in the source: the page, row and
+// column of its first letter, how many letters it covers and the direction
+// it is read in. Wrap is set when the run carries on from the opposite edge
+// of the page, see Trie.SetWrap.
+type Location struct {
+	Page int       `json:"page"`
+	Row  int       `json:"row"`
+	Col  int       `json:"col"`
+	Len  int       `json:"len"`
+	Dir  Direction `json:"dir"`
+	Wrap bool      `json:"wrap,omitempty"`
+}
+
+// LocationFromRaw converts a [page, row, col, len, direction] tuple.
+func LocationFromRaw(raw [5]int) Location {
+	return Location{
+		Page: raw[0],
+		Row:  raw[1],
+		Col:  raw[2],
+		Len:  raw[3],
+		Dir:  Direction(raw[4] &^ WrapBit),
+		Wrap: raw[4]&WrapBit != 0,
+	}
+}
+
+// LocationsFromRaw converts a list of [page, row, col, len, direction] tuples.
+func LocationsFromRaw(raw [][5]int) []Location {
+	if raw == nil {
+		return nil
+	}
+	locs := make([]Location, len(raw))
+	for i, r := range raw {
+		locs[i] = LocationFromRaw(r)
+	}
+	return locs
+}
+
+// Raw returns the location as a [page, row, col, len, direction] tuple.
+func (l Location) Raw() [5]int {
+	dir := int(l.Dir)
+	if l.Wrap {
+		dir |= WrapBit
+	}
+	return [5]int{l.Page, l.Row, l.Col, l.Len, dir}
+}
+
+// Offset returns the location with page, row and col shifted, e.g. to turn
+// zero based indexes into the numbers printed in a book.
+func (l Location) Offset(page, row, col int) Location {
+	l.Page += page
+	l.Row += row
+	l.Col += col
+	return l
+}
+
+// Cells returns the [page, row, col] of every letter the location covers.
+// The cells of a wrapped location run on past the edge of the page, use
+// WrapCells to fold them back onto it.
+func (l Location) Cells() [][3]int {
+	rowStep, colStep, ok := l.Dir.Delta()
+	if !ok {
+		return nil
+	}
+	cells := make([][3]int, l.Len)
+	for i := range cells {
+		cells[i] = [3]int{l.Page, l.Row + i*rowStep, l.Col + i*colStep}
+	}
+	return cells
+}
+
+// WrapCells is Cells for a location on a page of rows by cols letters,
+// folding every cell past an edge back onto the opposite side of the page.
+func (l Location) WrapCells(rows, cols int) [][3]int {
+	cells := l.Cells()
+	if rows <= 0 || cols <= 0 {
+		return cells
+	}
+	for i, c := range cells {
+		cells[i] = [3]int{c[0], wrapCell(c[1], rows), wrapCell(c[2], cols)}
+	}
+	return cells
+}
+
+// String returns the location as "page row col len direction".
+func (l Location) String() string {
+	text, _ := l.MarshalText()
+	return string(text)
+}
+
+// MarshalText encodes the location as "page row col len direction", followed
+// by "wrap" for a wrapped location.
+func (l Location) MarshalText() ([]byte, error) {
+	parts := []string{
+		strconv.Itoa(l.Page),
+		strconv.Itoa(l.Row),
+		strconv.Itoa(l.Col),
+		strconv.Itoa(l.Len),
+	}
+	if l.Dir != 0 {
+		parts = append(parts, l.Dir.String())
+	}
+	if l.Wrap {
+		parts = append(parts, locationWrap)
+	}
+	return []byte(strings.Join(parts, " ")), nil
+}
+
+// locationWrap ends the text of a wrapped location.
+const locationWrap = "wrap"
+
+// UnmarshalText decodes a location written by MarshalText. The direction is
+// optional, with or without the wrap marker.
+func (l *Location) UnmarshalText(text []byte) error {
+	fields := strings.Fields(string(text))
+	wrap := len(fields) > 4 && fields[len(fields)-1] == locationWrap
+	if wrap {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) != 4 && len(fields) != 5 {
+		return fmt.Errorf("invalid location: %q", text)
+	}
+
+	var nums [4]int
+	for i := range nums {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return fmt.Errorf("invalid location: %q", text)
+		}
+		nums[i] = n
+	}
+
+	var dir Direction
+	if len(fields) == 5 {
+		if err := dir.UnmarshalText([]byte(fields[4])); err != nil {
+			return err
+		}
+	}
+
+	*l = Location{Page: nums[0], Row: nums[1], Col: nums[2], Len: nums[3], Dir: dir, Wrap: wrap}
+	return nil
+}
+
+// jsonLocation stops encoding/json from using the text marshalling of Location.
+type jsonLocation Location
+
+// MarshalJSON encodes the location as an object.
+func (l Location) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonLocation(l))
+}
+
+// UnmarshalJSON decodes a location object.
+func (l *Location) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*jsonLocation)(l))
+}
+
+// MarshalText encodes the direction using its names, e.g. "right|left-down".
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a direction written by MarshalText.
+func (d *Direction) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = 0
+		return nil
+	}
+	dir, err := ParseDirection(string(text))
+	if err != nil {
+		return err
+	}
+	*d = dir
+	return nil
+}
+
+// EncodeLTR is ConstructPhraseLTR returning Locations.
+func (t *Trie) EncodeLTR(phrase string, dir Direction) ([]Location, error) {
+	raw, err := t.ConstructPhraseLTR(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	return LocationsFromRaw(raw), nil
+}
+
+// EncodeLongest is ConstructPhraseLongest returning Locations.
+func (t *Trie) EncodeLongest(phrase string, dir Direction) ([]Location, error) {
+	raw, err := t.ConstructPhraseLongest(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	return LocationsFromRaw(raw), nil
+}
+
+// EncodeOptimal is ConstructPhraseOptimal returning Locations.
+func (t *Trie) EncodeOptimal(phrase string, dir Direction) ([]Location, error) {
+	raw, err := t.ConstructPhraseOptimal(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	return LocationsFromRaw(raw), nil
+}
+
+// DecodeLocations is Decode for Locations.
+func DecodeLocations(source Source, locs []Location) (string, error) {
+	raw := make([][5]int, len(locs))
+	for i, l := range locs {
+		raw[i] = l.Raw()
+	}
+	return Decode(source, raw)
+}
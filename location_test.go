@@ -0,0 +1,124 @@
+package whcypher
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLocation_Raw(t *testing.T) {
+	raw := [5]int{1, 2, 3, 4, int(DirectionLeftDown)}
+	loc := LocationFromRaw(raw)
+	expected := Location{Page: 1, Row: 2, Col: 3, Len: 4, Dir: DirectionLeftDown}
+	if loc != expected {
+		t.Errorf("Expected %v, got %v", expected, loc)
+	}
+	if loc.Raw() != raw {
+		t.Errorf("Expected %v, got %v", raw, loc.Raw())
+	}
+}
+
+func TestLocation_Raw_Wrap(t *testing.T) {
+	raw := [5]int{1, 2, 3, 4, int(DirectionUp) | WrapBit}
+	loc := LocationFromRaw(raw)
+	expected := Location{Page: 1, Row: 2, Col: 3, Len: 4, Dir: DirectionUp, Wrap: true}
+	if loc != expected {
+		t.Errorf("Expected %v, got %v", expected, loc)
+	}
+	if loc.Raw() != raw {
+		t.Errorf("Expected %v, got %v", raw, loc.Raw())
+	}
+	if diff := cmp.Diff(loc.WrapCells(5, 5), [][3]int{{1, 2, 3}, {1, 1, 3}, {1, 0, 3}, {1, 4, 3}}); diff != "" {
+		t.Errorf("Expected cells to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestLocation_Offset(t *testing.T) {
+	loc := Location{Page: 0, Row: 1, Col: 2, Len: 3, Dir: DirectionUp}.Offset(3, 1, 1)
+	expected := Location{Page: 3, Row: 2, Col: 3, Len: 3, Dir: DirectionUp}
+	if loc != expected {
+		t.Errorf("Expected %v, got %v", expected, loc)
+	}
+}
+
+func TestLocation_Text(t *testing.T) {
+	testCases := []struct {
+		loc  Location
+		text string
+	}{
+		{loc: Location{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRight}, text: "3 2 1 4 right"},
+		{loc: Location{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionLeftDown}, text: "3 2 1 4 left-down"},
+		{loc: Location{Page: 3, Row: 2, Col: 1, Len: 4}, text: "3 2 1 4"},
+		{loc: Location{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionUp, Wrap: true}, text: "3 2 1 4 up wrap"},
+		{loc: Location{Page: 3, Row: 2, Col: 1, Len: 4, Wrap: true}, text: "3 2 1 4 wrap"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(t *testing.T) {
+			text, err := tc.loc.MarshalText()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if string(text) != tc.text {
+				t.Errorf("Expected %q, got %q", tc.text, text)
+			}
+
+			var loc Location
+			if err := loc.UnmarshalText(text); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if loc != tc.loc {
+				t.Errorf("Expected %v, got %v", tc.loc, loc)
+			}
+		})
+	}
+}
+
+func TestLocation_UnmarshalText_Invalid(t *testing.T) {
+	for _, text := range []string{"", "1 2 3", "1 2 3 x", "1 2 3 4 sideways", "1 2 3 4 right 5", "1 2 3 wrap", "1 2 3 4 wrap wrap"} {
+		var loc Location
+		if err := loc.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("Expected error for %q, got %v", text, loc)
+		}
+	}
+}
+
+func TestLocation_JSON(t *testing.T) {
+	locs := []Location{{Page: 3, Row: 2, Col: 1, Len: 4, Dir: DirectionRightUp}}
+	data, err := json.Marshal(locs)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := `[{"page":3,"row":2,"col":1,"len":4,"dir":"right-up"}]`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var decoded []Location
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if diff := cmp.Diff(decoded, locs); diff != "" {
+		t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestTrie_EncodeLongest(t *testing.T) {
+	trie := NewTrie()
+	for i, row := range []string{"fghooo", "ooabco", "oodeoo"} {
+		trie.InsertPageRow(DirectionRight, 0, i, row)
+	}
+	result, err := trie.EncodeLongest("abcdefgh", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []Location{
+		{Page: 0, Row: 1, Col: 2, Len: 3, Dir: DirectionRight},
+		{Page: 0, Row: 2, Col: 2, Len: 2, Dir: DirectionRight},
+		{Page: 0, Row: 0, Col: 0, Len: 3, Dir: DirectionRight},
+	}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+}
@@ -0,0 +1,96 @@
+package whcypher
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// NewTrieFromSourceParallel is NewTrieFromSource using up to workers
+// goroutines.
+func NewTrieFromSourceParallel(source Source, dir Direction, workers int) (*Trie, error) {
+	trie := NewTrie()
+	if err := trie.InsertSourceParallel(source, dir, workers); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// InsertSourceParallel is InsertSource using up to workers goroutines, or
+// one per CPU when workers is 0 or less. Runs starting with different
+// letters never share a node, so each goroutine builds the subtrees of the
+// letters it takes, inserting in the same order as InsertSource. The
+// result is identical to InsertSource.
+func (t *Trie) InsertSourceParallel(source Source, dir Direction, workers int) error {
+	if t.index != nil {
+		return errors.New("can not insert into a trie searching a suffix index")
+	}
+	if err := t.validateSource(source); err != nil {
+		return err
+	}
+	walk, err := t.sourceWalk(source)
+	if err != nil {
+		return err
+	}
+	t.built |= dir & DirectionAll
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	letters := t.alphabet.Len()
+
+	// Each worker inserts into a root of its own, holding only the subtree
+	// of the letter it is working on.
+	subtrees := make([]*Node, letters)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, letters); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			root := &Node{Children: make([]*Node, letters)}
+			for letter := range jobs {
+				root.Children[letter] = t.RootNode.Child(letter)
+				t.insertLetter(root, source, walk, dir, letter)
+				subtrees[letter] = root.Children[letter]
+				root.Children[letter] = nil
+			}
+		}()
+	}
+	for letter := 0; letter < letters; letter++ {
+		jobs <- letter
+	}
+	close(jobs)
+	wg.Wait()
+
+	for letter, subtree := range subtrees {
+		if subtree == nil {
+			continue
+		}
+		if t.RootNode.Children == nil {
+			t.RootNode.Children = make([]*Node, letters)
+		}
+		t.RootNode.Children[letter] = subtree
+	}
+	return nil
+}
+
+// insertLetter inserts every run in the source read by walk for the
+// directions in dir that starts with the letter at index letter of the
+// alphabet.
+func (t *Trie) insertLetter(root *Node, source Source, walk func(page, row, col int, dir Direction) []rune, dir Direction, letter int) {
+	directions := dir.Directions()
+	for pi, page := range source {
+		for ri, row := range page {
+			for ci, r := range row {
+				if index, _ := t.alphabet.Index(r); index != letter {
+					continue
+				}
+				for _, d := range directions {
+					// The source was validated, so this can not fail.
+					t.insertRun(root, d, pi, ri, ci, walk(pi, ri, ci, d))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package whcypher
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTrie_InsertSourceParallel(t *testing.T) {
+	source := testSource(t, "abcabc\nbcabca\ncab\n")
+	expected, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var want bytes.Buffer
+	if err := expected.WriteIndex(&want, source, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, workers := range []int{0, 1, 3, 64} {
+		trie, err := NewTrieFromSourceParallel(source, DirectionAll, workers)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		var got bytes.Buffer
+		if err := trie.WriteIndex(&got, source, ""); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("Expected %d workers to build the same trie", workers)
+		}
+	}
+
+	// Adding directions to an existing trie matches inserting them
+	// sequentially too.
+	trie := NewTrie()
+	if err := trie.InsertSource(source, DirectionRight|DirectionDown); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := trie.InsertSourceParallel(source, DirectionAll&^(DirectionRight|DirectionDown), 4); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	sequential := NewTrie()
+	sequential.InsertSource(source, DirectionRight|DirectionDown)
+	sequential.InsertSource(source, DirectionAll&^(DirectionRight|DirectionDown))
+	var got, again bytes.Buffer
+	trie.WriteIndex(&got, source, "")
+	sequential.WriteIndex(&again, source, "")
+	if !bytes.Equal(got.Bytes(), again.Bytes()) {
+		t.Error("Expected parallel insert into an existing trie to match")
+	}
+
+	if _, err := NewTrieFromSourceParallel(Source{{[]rune("ab1")}}, DirectionRight, 2); err == nil {
+		t.Error("Expected invalid character error, got nil")
+	}
+}
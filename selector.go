@@ -0,0 +1,46 @@
+package whcypher
+
+import "errors"
+
+// LocationSelector chooses which of the locations holding a run of the
+// phrase to use.
+type LocationSelector interface {
+	// SelectLocation returns the index of the candidate to use for run, the
+	// part of the phrase being encoded, given the locations already chosen
+	// for the phrase. An index past the end picks the last candidate and a
+	// negative index rejects them all.
+	SelectLocation(candidates []Location, run string, chosen []Location) int
+}
+
+// LocationSelectorFunc adapts a function to a LocationSelector.
+type LocationSelectorFunc func(candidates []Location, run string, chosen []Location) int
+
+// SelectLocation calls f.
+func (f LocationSelectorFunc) SelectLocation(candidates []Location, run string, chosen []Location) int {
+	return f(candidates, run, chosen)
+}
+
+// SetLocationSelector sets the policy used to choose between locations.
+func (t *Trie) SetLocationSelector(s LocationSelector) {
+	t.selector = s
+}
+
+// selectLocation returns the index of the candidate to use for run, or -1
+// when the selector rejects every candidate.
+func (t *Trie) selectLocation(candidates []Location, run string, chosen []Location) int {
+	i := t.selector.SelectLocation(candidates, run, chosen)
+	if i < 0 {
+		return -1
+	}
+	return min(i, len(candidates)-1)
+}
+
+// pickLocation is selectLocation for raw locations, failing when the
+// selector rejects every candidate.
+func (t *Trie) pickLocation(candidates [][5]int, run string, chosen [][5]int) ([5]int, error) {
+	i := t.selectLocation(LocationsFromRaw(candidates), run, LocationsFromRaw(chosen))
+	if i < 0 {
+		return [5]int{}, errors.New("no location accepted for: " + run)
+	}
+	return candidates[i], nil
+}
@@ -0,0 +1,73 @@
+package whcypher
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTrie_SetLocationSelector(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcab")
+	trie.InsertPageRow(DirectionRight, 1, 0, "abcab")
+
+	var runs []string
+	var chosenLens []int
+	// Prefer the last page offered.
+	trie.SetLocationSelector(LocationSelectorFunc(func(candidates []Location, run string, chosen []Location) int {
+		runs = append(runs, run)
+		chosenLens = append(chosenLens, len(chosen))
+		best := 0
+		for i, c := range candidates {
+			if c.Page > candidates[best].Page {
+				best = i
+			}
+		}
+		return best
+	}))
+
+	result, err := trie.ConstructPhraseLTR("cab ab", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := [][5]int{{1, 0, 2, 3, 1}, {1, 0, 0, 2, 1}}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+	if diff := cmp.Diff(runs, []string{"cab", "ab"}); diff != "" {
+		t.Errorf("Expected runs to match, got diff (-got,+want) %s", diff)
+	}
+	if diff := cmp.Diff(chosenLens, []int{0, 1}); diff != "" {
+		t.Errorf("Expected chosen to grow, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestTrie_SetLocationSelector_Reject(t *testing.T) {
+	// Reject every run longer than one letter.
+	reject := LocationSelectorFunc(func(candidates []Location, run string, chosen []Location) int {
+		if len(run) > 1 {
+			return -1
+		}
+		return 0
+	})
+
+	for _, strategy := range []Strategy{StrategyLTR, StrategyLongest, StrategyOptimal} {
+		trie := NewTrie()
+		trie.InsertPageRow(DirectionRight, 0, 0, "abc")
+		trie.SetLocationSelector(reject)
+
+		if _, err := trie.Encode("abc", DirectionRight, EncodeOptions{Strategy: strategy}); err == nil {
+			t.Errorf("Expected rejected location error for strategy %d, got nil", strategy)
+		}
+
+		// The backtracking search falls back to shorter runs.
+		result, err := trie.Encode("abc", DirectionRight, EncodeOptions{Strategy: strategy, NoReuse: true})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := []Location{{Page: 0, Row: 0, Col: 0, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 1, Len: 1, Dir: DirectionRight}, {Page: 0, Row: 0, Col: 2, Len: 1, Dir: DirectionRight}}
+		if diff := cmp.Diff(result, expected); diff != "" {
+			t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package whcypher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Source is the grid of letters codes are built from, addressed as
+// source[page][row][col]. Pages are separated by blank lines. Columns count
+// letters, not bytes, so rows may hold any Unicode letters.
+type Source [][][]rune
+
+// maxSourceRow is the most bytes in one row of a source read by ParseSource,
+// well above the rows of any real book.
+const maxSourceRow = 1 << 26
+
+// ParseSource reads a UTF-8 source with one row of letters per line and a
+// blank line between pages. Only the first blank line ends a page: a leading
+// blank line, or any blank line after the one ending a page, is kept as an
+// empty row, and a further separator as an empty page, so rows and pages are
+// numbered as they were when sources were split on "\n\n". Blank rows at the
+// end of a page and empty pages at the end of the source are dropped.
+func ParseSource(r io.Reader) (Source, error) {
+	var (
+		source Source
+		page   [][]rune
+		line   int
+		split  bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxSourceRow)
+	for scanner.Scan() {
+		line++
+		row := strings.TrimRight(scanner.Text(), "\r")
+		if len(row) == 0 && line > 1 && !split {
+			source = append(source, trimRows(page))
+			page = nil
+			split = true
+			continue
+		}
+		split = false
+		if !utf8.ValidString(row) {
+			return nil, fmt.Errorf("invalid UTF-8 on line %d", line)
+		}
+		page = append(page, []rune(row))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	source = append(source, trimRows(page))
+	for len(source) > 0 && len(source[len(source)-1]) == 0 {
+		source = source[:len(source)-1]
+	}
+	if len(source) == 0 {
+		return nil, nil
+	}
+	return source, nil
+}
+
+// trimRows drops the blank rows at the end of a page.
+func trimRows(page [][]rune) [][]rune {
+	for len(page) > 0 && len(page[len(page)-1]) == 0 {
+		page = page[:len(page)-1]
+	}
+	if len(page) == 0 {
+		return nil
+	}
+	return page
+}
+
+// Cell returns the letter at page, row and col. ok is false when the cell is
+// outside the source.
+func (s Source) Cell(page, row, col int) (letter rune, ok bool) {
+	if page < 0 || page >= len(s) {
+		return 0, false
+	}
+	if row < 0 || row >= len(s[page]) {
+		return 0, false
+	}
+	if col < 0 || col >= len(s[page][row]) {
+		return 0, false
+	}
+	return s[page][row][col], true
+}
+
+// Walk returns the letters read from page, row and col in a single direction
+// until the edge of the page.
+func (s Source) Walk(page, row, col int, dir Direction) []rune {
+	rowStep, colStep, ok := dir.Delta()
+	if !ok {
+		return nil
+	}
+
+	letters := make([]rune, 0)
+	for {
+		letter, ok := s.Cell(page, row, col)
+		if !ok {
+			return letters
+		}
+		letters = append(letters, letter)
+		row += rowStep
+		col += colStep
+	}
+}
+
+// NewTrieFromSource builds a trie over every run in the source for the
+// directions in dir.
+func NewTrieFromSource(source Source, dir Direction) (*Trie, error) {
+	trie := NewTrie()
+	if err := trie.InsertSource(source, dir); err != nil {
+		return nil, err
+	}
+	return trie, nil
+}
+
+// InsertSource inserts every run in the source for the directions in dir.
+// Every letter of the source must be in the trie's alphabet.
+func (t *Trie) InsertSource(source Source, dir Direction) error {
+	if t.index != nil {
+		return errors.New("can not insert into a trie searching a suffix index")
+	}
+	if err := t.validateSource(source); err != nil {
+		return err
+	}
+	walk, err := t.sourceWalk(source)
+	if err != nil {
+		return err
+	}
+	t.built |= dir & DirectionAll
+
+	directions := dir.Directions()
+	for pi, page := range source {
+		for ri, row := range page {
+			for ci := range row {
+				for _, d := range directions {
+					if err := t.insertRun(t.RootNode, d, pi, ri, ci, walk(pi, ri, ci, d)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AddDirections inserts the runs of the source for the directions in dir
+// that have not been inserted yet, so a trie built for a few directions can
+// be extended later. The source must be the one the trie was built from.
+func (t *Trie) AddDirections(source Source, dir Direction) error {
+	if t.index != nil {
+		t.index.AddDirections(source, dir)
+		return nil
+	}
+	return t.InsertSource(source, dir&^t.Directions())
+}
+
+// validateSource fails on the first letter of the source that is not in the
+// trie's alphabet, with its column as the position.
+func (t *Trie) validateSource(source Source) error {
+	for pi, page := range source {
+		for ri, row := range page {
+			for ci, r := range row {
+				if !t.alphabet.Contains(r) {
+					return fmt.Errorf("invalid characters in source on page %d row %d: %w", pi, ri, &InvalidCharacterError{Pos: ci, Rune: r})
+				}
+			}
+		}
+	}
+	return nil
+}
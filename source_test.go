@@ -0,0 +1,202 @@
+package whcypher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSource(t *testing.T) {
+	testCases := []struct {
+		description string
+		input       string
+		expected    Source
+	}{
+		{
+			description: "Single page",
+			input:       "abc\ndef\n",
+			expected:    Source{{[]rune("abc"), []rune("def")}},
+		},
+		{
+			description: "Multiple pages",
+			input:       "abc\ndef\n\nghi\n",
+			expected:    Source{{[]rune("abc"), []rune("def")}, {[]rune("ghi")}},
+		},
+		{
+			description: "Windows line endings",
+			input:       "abc\r\ndef\r\n\r\nghi\r\n",
+			expected:    Source{{[]rune("abc"), []rune("def")}, {[]rune("ghi")}},
+		},
+		{
+			description: "Leading blank line is row 0",
+			input:       "\nabc\n",
+			expected:    Source{{[]rune(""), []rune("abc")}},
+		},
+		{
+			description: "Second blank line between pages is row 0",
+			input:       "abc\n\n\nghi",
+			expected:    Source{{[]rune("abc")}, {[]rune(""), []rune("ghi")}},
+		},
+		{
+			description: "Third blank line between pages is an empty page",
+			input:       "abc\n\n\n\nghi",
+			expected:    Source{{[]rune("abc")}, nil, {[]rune("ghi")}},
+		},
+		{
+			description: "Trailing blank lines",
+			input:       "abc\n\n\n\n\n",
+			expected:    Source{{[]rune("abc")}},
+		},
+		{
+			description: "Unicode letters",
+			input:       "größe\nniño\n",
+			expected:    Source{{[]rune("größe"), []rune("niño")}},
+		},
+		{
+			description: "Empty",
+			input:       "",
+			expected:    nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			source, err := ParseSource(strings.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if diff := cmp.Diff(source, tc.expected); diff != "" {
+				t.Errorf("Expected source to match, got diff (-got,+want) %s", diff)
+			}
+		})
+	}
+}
+
+func TestSource_Cell(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("de")}}
+	if l, ok := source.Cell(0, 1, 1); !ok || l != 'e' {
+		t.Errorf("Expected e, got %q %v", l, ok)
+	}
+	for _, cell := range [][3]int{{1, 0, 0}, {0, 2, 0}, {0, 1, 2}, {0, -1, 0}} {
+		if l, ok := source.Cell(cell[0], cell[1], cell[2]); ok {
+			t.Errorf("Expected %v to be outside the source, got %q", cell, l)
+		}
+	}
+}
+
+func TestParseSource_InvalidUTF8(t *testing.T) {
+	if _, err := ParseSource(strings.NewReader("abc\n\xffbc\n")); err == nil {
+		t.Error("Expected invalid UTF-8 error, got nil")
+	}
+}
+
+func TestParseSource_LongRow(t *testing.T) {
+	row := strings.Repeat("abc", 1<<16)
+	source, err := ParseSource(strings.NewReader("xyz\n" + row + "\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(source) != 1 || len(source[0]) != 2 || string(source[0][1]) != row {
+		t.Errorf("Expected a page with a row of %d letters, got %d pages", len(row), len(source))
+	}
+}
+
+func TestSource_Walk(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("def"), []rune("ghi")}}
+	testCases := []struct {
+		dir      Direction
+		row, col int
+		expected string
+	}{
+		{dir: DirectionRight, row: 1, col: 0, expected: "def"},
+		{dir: DirectionLeft, row: 1, col: 1, expected: "ed"},
+		{dir: DirectionUp, row: 2, col: 2, expected: "ifc"},
+		{dir: DirectionDown, row: 0, col: 0, expected: "adg"},
+		{dir: DirectionRightDown, row: 0, col: 0, expected: "aei"},
+		{dir: DirectionLeftDown, row: 0, col: 2, expected: "ceg"},
+		{dir: DirectionRightUp, row: 2, col: 0, expected: "gec"},
+		{dir: DirectionLeftUp, row: 2, col: 1, expected: "hd"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.dir.String(), func(t *testing.T) {
+			if result := string(source.Walk(0, tc.row, tc.col, tc.dir)); result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestNewTrieFromSource(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("def"), []rune("ghi")}}
+	trie, err := NewTrieFromSource(source, DirectionRight|DirectionDown)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	index, locations := trie.SearchLetters("beh", DirectionDown)
+	if index != 3 {
+		t.Errorf("Expected length found 3, got %d", index)
+	}
+	if diff := cmp.Diff(locations, [][5]int{{0, 0, 1, 3, int(DirectionDown)}}); diff != "" {
+		t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+	}
+
+	if index, _ := trie.SearchLetters("cba", DirectionLeft); index != 0 {
+		t.Errorf("Expected left to not be indexed, got %d", index)
+	}
+}
+
+func TestNewTrieFromSource_InvalidCharacter(t *testing.T) {
+	if _, err := NewTrieFromSource(Source{{[]rune("ab1")}}, DirectionRight); err == nil {
+		t.Error("Expected invalid character error, got nil")
+	}
+}
+
+func TestTrie_AddDirections(t *testing.T) {
+	source := Source{{[]rune("abc"), []rune("def"), []rune("ghi")}}
+	index, err := NewSuffixIndex(source, DirectionRight, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie, err := NewTrieFromSource(source, DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for name, trie := range map[string]*Trie{"Trie": trie, "Index": NewTrieWithIndex(index)} {
+		t.Run(name, func(t *testing.T) {
+			var notBuilt *DirectionNotBuiltError
+			_, err := trie.ConstructPhraseLTR("beh", DirectionDown)
+			if !errors.As(err, &notBuilt) {
+				t.Fatalf("Expected direction not built error, got %v", err)
+			}
+			if notBuilt.Missing != DirectionDown || notBuilt.Built != DirectionRight {
+				t.Errorf("Expected down missing from right, got %v missing from %v", notBuilt.Missing, notBuilt.Built)
+			}
+
+			if err := trie.AddDirections(source, DirectionRight|DirectionDown); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if trie.Directions() != DirectionRight|DirectionDown {
+				t.Errorf("Expected right and down built, got %v", trie.Directions())
+			}
+			if err := trie.CheckDirections(DirectionDown); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+
+			index, locations := trie.SearchLetters("beh", DirectionDown)
+			if index != 3 {
+				t.Errorf("Expected length found 3, got %d", index)
+			}
+			if diff := cmp.Diff(locations, [][5]int{{0, 0, 1, 3, int(DirectionDown)}}); diff != "" {
+				t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+			}
+			if index, _ := trie.SearchLetters("abc", DirectionRight); index != 3 {
+				t.Errorf("Expected right to stay indexed, got %d", index)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package whcypher
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// SuffixIndex finds runs of letters like a trie, but keeps one suffix array
+// per direction instead of a node and a location list for every prefix of
+// every run. Its memory grows linearly with the size of the source.
+type SuffixIndex struct {
+	alphabet *Alphabet
+	built    Direction
+	arrays   map[Direction]*suffixArray
+	// sizes holds the rows and columns of every page when runs wrap
+	// around the page edges, and is nil otherwise.
+	sizes [][2]int
+}
+
+// suffixArray holds the lines of a source read in one direction.
+type suffixArray struct {
+	dir              Direction
+	rowStep, colStep int
+
+	// text holds the letters of every line as their alphabet index plus
+	// one, each line ended by 0.
+	text []uint16
+	// suffixes holds the position in text of every letter, sorted by the
+	// letters from there to the end of its line.
+	suffixes []int32
+	// lineStarts holds the position in text where each line starts, in
+	// order, and lineCells the cell it starts from.
+	lineStarts []int32
+	lineCells  [][3]int32
+
+	// When runs wrap, each line holds a cycle of cells followed by all
+	// but its last letter again. ends then holds the position in text
+	// where each suffix stops, a whole cycle after it starts, and sizes the
+	// rows and columns of every page.
+	ends  []int32
+	sizes [][2]int
+}
+
+// NewSuffixIndex indexes every run in the source for the directions in dir.
+// Every letter of the source must be in the alphabet.
+func NewSuffixIndex(source Source, dir Direction, alphabet *Alphabet) (*SuffixIndex, error) {
+	return newSuffixIndex(source, dir, alphabet, false)
+}
+
+// NewWrappedSuffixIndex is NewSuffixIndex for runs that wrap around the edges
+// of each page, as indexed by a trie after Trie.SetWrap.
+func NewWrappedSuffixIndex(source Source, dir Direction, alphabet *Alphabet) (*SuffixIndex, error) {
+	return newSuffixIndex(source, dir, alphabet, true)
+}
+
+func newSuffixIndex(source Source, dir Direction, alphabet *Alphabet, wrap bool) (*SuffixIndex, error) {
+	if len(alphabet.letters) >= 1<<16-1 {
+		return nil, errors.New("alphabet too large for a suffix index")
+	}
+	x := &SuffixIndex{
+		alphabet: alphabet,
+		built:    dir & DirectionAll,
+		arrays:   make(map[Direction]*suffixArray),
+	}
+	t := &Trie{alphabet: alphabet}
+	if err := t.validateSource(source); err != nil {
+		return nil, err
+	}
+	if wrap {
+		sizes, err := pageSizes(source)
+		if err != nil {
+			return nil, err
+		}
+		x.sizes = sizes
+	}
+	grid := newLetterGrid(source, alphabet)
+	for _, d := range x.built.Directions() {
+		x.arrays[d] = x.newSuffixArray(grid, d)
+	}
+	return x, nil
+}
+
+// letterGrid holds the letters of a source as the values held in text, so
+// they are looked up in the alphabet once rather than for every direction.
+type letterGrid [][][]uint16
+
+// newLetterGrid converts a source whose letters are all in the alphabet.
+func newLetterGrid(source Source, alphabet *Alphabet) letterGrid {
+	grid := make(letterGrid, len(source))
+	for pi, page := range source {
+		grid[pi] = make([][]uint16, len(page))
+		for ri, row := range page {
+			grid[pi][ri] = make([]uint16, len(row))
+			for ci, r := range row {
+				index, _ := alphabet.Index(r)
+				grid[pi][ri][ci] = uint16(index + 1)
+			}
+		}
+	}
+	return grid
+}
+
+// cell is Source.Cell for the grid.
+func (g letterGrid) cell(page, row, col int) (uint16, bool) {
+	if page < 0 || page >= len(g) || row < 0 || row >= len(g[page]) || col < 0 || col >= len(g[page][row]) {
+		return 0, false
+	}
+	return g[page][row][col], true
+}
+
+// newSuffixArray indexes the grid in a single direction.
+func (x *SuffixIndex) newSuffixArray(grid letterGrid, dir Direction) *suffixArray {
+	if x.sizes != nil {
+		return newWrappedSuffixArray(grid, dir, x.sizes)
+	}
+	return newSuffixArray(grid, dir)
+}
+
+// layoutSuffixArray lays out the lines of the grid in a single direction
+// with the suffixes in text order, as newSuffixArray does before sorting.
+func (x *SuffixIndex) layoutSuffixArray(grid letterGrid, dir Direction) *suffixArray {
+	if x.sizes != nil {
+		return layoutWrappedSuffixArray(grid, dir, x.sizes)
+	}
+	return layoutSuffixArray(grid, dir)
+}
+
+func newSuffixArray(grid letterGrid, dir Direction) *suffixArray {
+	a := layoutSuffixArray(grid, dir)
+	slices.SortFunc(a.suffixes, func(i, j int32) int {
+		for {
+			x, y := a.text[i], a.text[j]
+			if x != y || x == 0 {
+				return int(x) - int(y)
+			}
+			i++
+			j++
+		}
+	})
+	return a
+}
+
+func layoutSuffixArray(grid letterGrid, dir Direction) *suffixArray {
+	rowStep, colStep, _ := dir.Delta()
+	a := &suffixArray{dir: dir, rowStep: rowStep, colStep: colStep}
+
+	letters := 0
+	for pi, page := range grid {
+		for ri, row := range page {
+			letters += len(row)
+			for ci := range row {
+				// A line starts at every cell that can not be reached by
+				// walking one step in dir.
+				if _, ok := grid.cell(pi, ri-rowStep, ci-colStep); ok {
+					continue
+				}
+				a.lineCells = append(a.lineCells, [3]int32{int32(pi), int32(ri), int32(ci)})
+			}
+		}
+	}
+
+	// The arrays are sized up front as this runs for every direction each
+	// time a saved index is loaded.
+	a.lineStarts = make([]int32, 0, len(a.lineCells))
+	a.text = make([]uint16, 0, letters+len(a.lineCells))
+	a.suffixes = make([]int32, 0, letters)
+	for _, start := range a.lineCells {
+		a.lineStarts = append(a.lineStarts, int32(len(a.text)))
+		pi, ri, ci := int(start[0]), int(start[1]), int(start[2])
+		for {
+			l, ok := grid.cell(pi, ri, ci)
+			if !ok {
+				break
+			}
+			a.suffixes = append(a.suffixes, int32(len(a.text)))
+			a.text = append(a.text, l)
+			ri, ci = ri+rowStep, ci+colStep
+		}
+		a.text = append(a.text, 0)
+	}
+	return a
+}
+
+func newWrappedSuffixArray(grid letterGrid, dir Direction, sizes [][2]int) *suffixArray {
+	a := layoutWrappedSuffixArray(grid, dir, sizes)
+
+	type suffix struct{ pos, end int32 }
+	suffixes := make([]suffix, len(a.suffixes))
+	for i, pos := range a.suffixes {
+		suffixes[i] = suffix{pos, a.ends[i]}
+	}
+	at := func(s suffix, k int32) uint16 {
+		if s.pos+k >= s.end {
+			return 0
+		}
+		return a.text[s.pos+k]
+	}
+	slices.SortFunc(suffixes, func(s, u suffix) int {
+		for k := int32(0); ; k++ {
+			x, y := at(s, k), at(u, k)
+			if x != y || x == 0 {
+				return int(x) - int(y)
+			}
+		}
+	})
+	for i, s := range suffixes {
+		a.suffixes[i], a.ends[i] = s.pos, s.end
+	}
+	return a
+}
+
+func layoutWrappedSuffixArray(grid letterGrid, dir Direction, sizes [][2]int) *suffixArray {
+	rowStep, colStep, _ := dir.Delta()
+	a := &suffixArray{dir: dir, rowStep: rowStep, colStep: colStep, sizes: sizes}
+
+	// Each cell starts one suffix and is held about twice in text.
+	cells := 0
+	for _, size := range sizes {
+		cells += size[0] * size[1]
+	}
+	a.text = make([]uint16, 0, 2*cells)
+	a.suffixes = make([]int32, 0, cells)
+	a.ends = make([]int32, 0, cells)
+	for pi, size := range sizes {
+		rows, cols := size[0], size[1]
+		seen := make([]bool, rows*cols)
+		for ri := 0; ri < rows; ri++ {
+			for ci := 0; ci < cols; ci++ {
+				// Every cell is on exactly one cycle, which is indexed
+				// from the first of its cells found.
+				if seen[ri*cols+ci] {
+					continue
+				}
+				start := int32(len(a.text))
+				a.lineStarts = append(a.lineStarts, start)
+				a.lineCells = append(a.lineCells, [3]int32{int32(pi), int32(ri), int32(ci)})
+				r, c := ri, ci
+				for {
+					seen[r*cols+c] = true
+					a.suffixes = append(a.suffixes, int32(len(a.text)))
+					a.text = append(a.text, grid[pi][r][c])
+					// Steps are at most one cell, so wrapping needs no
+					// division.
+					r, c = r+rowStep, c+colStep
+					if r < 0 {
+						r += rows
+					} else if r >= rows {
+						r -= rows
+					}
+					if c < 0 {
+						c += cols
+					} else if c >= cols {
+						c -= cols
+					}
+					if r == ri && c == ci {
+						break
+					}
+				}
+				n := int32(len(a.text)) - start
+				for i := start; i < start+n; i++ {
+					a.ends = append(a.ends, i+n)
+				}
+				a.text = append(a.text, a.text[start:start+n-1]...)
+				a.text = append(a.text, 0)
+			}
+		}
+	}
+	return a
+}
+
+// AddDirections indexes the source for the directions in dir that are not
+// indexed yet. The source must be the one the index was built from.
+func (x *SuffixIndex) AddDirections(source Source, dir Direction) {
+	grid := newLetterGrid(source, x.alphabet)
+	for _, d := range (dir &^ x.built).Directions() {
+		x.arrays[d] = x.newSuffixArray(grid, d)
+		x.built |= d
+	}
+}
+
+// Directions returns the directions the index was built for.
+func (x *SuffixIndex) Directions() Direction {
+	return x.built
+}
+
+// Wraps reports whether the index holds runs that wrap around the page
+// edges.
+func (x *SuffixIndex) Wraps() bool {
+	return x.sizes != nil
+}
+
+// SearchLetters is Trie.SearchLetters for the index, giving the same
+// results for a trie built from the same source and directions.
+func (x *SuffixIndex) SearchLetters(term string, dir Direction) (int, [][5]int) {
+	return x.search([]rune(term), dir)
+}
+
+func (x *SuffixIndex) search(term []rune, dir Direction) (int, [][5]int) {
+	letters := x.letters(term)
+
+	longest := 0
+	ranges := make(map[Direction][2]int)
+	for _, d := range dir.Directions() {
+		a, ok := x.arrays[d]
+		if !ok {
+			continue
+		}
+		n, lo, hi := a.narrow(letters, nil)
+		if n > longest {
+			longest = n
+			clear(ranges)
+		}
+		if n == longest {
+			ranges[d] = [2]int{lo, hi}
+		}
+	}
+
+	locs := [][5]int{}
+	if longest == 0 {
+		return 0, locs
+	}
+	for _, d := range dir.Directions() {
+		r, ok := ranges[d]
+		if !ok {
+			continue
+		}
+		start := len(locs)
+		a := x.arrays[d]
+		for _, pos := range a.suffixes[r[0]:r[1]] {
+			cell := a.cell(pos)
+			locs = append(locs, [5]int{cell[0], cell[1], cell[2], longest, int(d)})
+		}
+		slices.SortFunc(locs[start:], func(p, q [5]int) int {
+			return compareCells(p, q)
+		})
+	}
+	return longest, locs
+}
+
+// prefixCounts returns the number of locations of every prefix of the term
+// that is found, shortest first.
+func (x *SuffixIndex) prefixCounts(term []rune, dir Direction) []int {
+	letters := x.letters(term)
+
+	counts := []int{}
+	for _, d := range dir.Directions() {
+		a, ok := x.arrays[d]
+		if !ok {
+			continue
+		}
+		a.narrow(letters, func(depth, n int) {
+			if depth > len(counts) {
+				counts = append(counts, 0)
+			}
+			counts[depth-1] += n
+		})
+	}
+	return counts
+}
+
+// letters converts the term to the values held in text, stopping at the
+// first letter outside the alphabet.
+func (x *SuffixIndex) letters(term []rune) []uint16 {
+	letters := make([]uint16, 0, len(term))
+	for _, r := range term {
+		index, ok := x.alphabet.Index(r)
+		if !ok {
+			break
+		}
+		letters = append(letters, uint16(index+1))
+	}
+	return letters
+}
+
+// narrow returns the longest prefix of the letters found and the range of
+// suffixes starting with it. found is called with the number of suffixes
+// for each prefix length found.
+func (a *suffixArray) narrow(letters []uint16, found func(depth, n int)) (n, lo, hi int) {
+	lo, hi = 0, len(a.suffixes)
+	for k, l := range letters {
+		next := a.suffixes[lo:hi]
+		first := sort.Search(len(next), func(i int) bool {
+			return a.at(lo+i, k) >= l
+		})
+		last := sort.Search(len(next), func(i int) bool {
+			return a.at(lo+i, k) > l
+		})
+		if first == last {
+			break
+		}
+		lo, hi = lo+first, lo+last
+		n = k + 1
+		if found != nil {
+			found(n, hi-lo)
+		}
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return n, lo, hi
+}
+
+// at returns the value k letters into the suffix at index i of suffixes, or
+// 0 past its end.
+func (a *suffixArray) at(i, k int) uint16 {
+	pos := a.suffixes[i] + int32(k)
+	if a.ends != nil && pos >= a.ends[i] {
+		return 0
+	}
+	return a.text[pos]
+}
+
+// cell returns the page, row and column of the letter at pos in text.
+func (a *suffixArray) cell(pos int32) [3]int {
+	line := sort.Search(len(a.lineStarts), func(i int) bool {
+		return a.lineStarts[i] > pos
+	}) - 1
+	steps := int(pos - a.lineStarts[line])
+	start := a.lineCells[line]
+	cell := [3]int{
+		int(start[0]),
+		int(start[1]) + steps*a.rowStep,
+		int(start[2]) + steps*a.colStep,
+	}
+	if a.sizes != nil {
+		size := a.sizes[cell[0]]
+		cell[1], cell[2] = wrapCell(cell[1], size[0]), wrapCell(cell[2], size[1])
+	}
+	return cell
+}
+
+// compareCells orders locations by page, row and column.
+func compareCells(a, b [5]int) int {
+	for i := 0; i < 3; i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+// NewTrieWithIndex returns a trie that searches the index instead of its own
+// nodes, so every encoder can use it. Nothing can be inserted into it.
+func NewTrieWithIndex(x *SuffixIndex) *Trie {
+	t := NewTrieWithAlphabet(x.alphabet)
+	t.index = x
+	t.wrap, t.sizes = x.sizes != nil, x.sizes
+	return t
+}
@@ -0,0 +1,124 @@
+package whcypher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSuffixIndex_SearchLetters(t *testing.T) {
+	testCases := []struct {
+		description string
+		source      string
+		alphabet    *Alphabet
+	}{
+		{
+			description: "Square pages",
+			source:      testPage + "\nabcabc\nbcabca\ncabcab\n",
+			alphabet:    AlphabetLatin,
+		},
+		{
+			description: "Ragged rows",
+			source:      "abcd\nab\nabcdef\nc\n",
+			alphabet:    AlphabetLatin,
+		},
+		{
+			description: "Unicode",
+			source:      "straße\nniño\nsüß\n",
+			alphabet:    MustAlphabet("abcdefghijklmnopqrstuvwxyzßñü"),
+		},
+	}
+
+	masks := []Direction{DirectionRight, DirectionLeft | DirectionDown, DirectionDiag, DirectionAll}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			source, err := ParseSource(strings.NewReader(tc.source))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			trie := NewTrieWithAlphabet(tc.alphabet)
+			if err := trie.InsertSource(source, DirectionAll); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			index, err := NewSuffixIndex(source, DirectionAll, tc.alphabet)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			// Every run in the source, and each with a letter that breaks it.
+			terms := []string{"", "q", "zzz", "a1"}
+			for pi, page := range source {
+				for ri, row := range page {
+					for ci := range row {
+						for _, d := range DirectionAll.Directions() {
+							run := string(source.Walk(pi, ri, ci, d))
+							terms = append(terms, run, run+"x", "x"+run)
+						}
+					}
+				}
+			}
+
+			for _, dir := range masks {
+				for _, term := range terms {
+					expectedIndex, expectedLocs := trie.SearchLetters(term, dir)
+					index, locs := index.SearchLetters(term, dir)
+					if index != expectedIndex {
+						t.Fatalf("Expected %q in %v to match %d letters, got %d", term, dir, expectedIndex, index)
+					}
+					if diff := cmp.Diff(locs, expectedLocs); diff != "" {
+						t.Fatalf("Expected %q in %v locations to match, got diff (-got,+want) %s", term, dir, diff)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewTrieWithIndex(t *testing.T) {
+	source := testSource(t)
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	index, err := NewSuffixIndex(source, DirectionAll, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	indexed := NewTrieWithIndex(index)
+
+	phrase := "the random letters are a mess"
+	for _, strategy := range []Strategy{StrategyLTR, StrategyLongest, StrategyOptimal} {
+		expected, err := trie.Encode(phrase, DirectionAll, EncodeOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result, err := indexed.Encode(phrase, DirectionAll, EncodeOptions{Strategy: strategy})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if diff := cmp.Diff(result, expected); diff != "" {
+			t.Errorf("Expected strategy %d to match the trie, got diff (-got,+want) %s", strategy, diff)
+		}
+	}
+
+	expected, err := trie.Entropy(phrase, DirectionRight|DirectionDown)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := indexed.Entropy(phrase, DirectionRight|DirectionDown)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Encodings.Cmp(expected.Encodings) != 0 {
+		t.Errorf("Expected %v encodings, got %v", expected.Encodings, result.Encodings)
+	}
+	if diff := cmp.Diff(result.Positions, expected.Positions); diff != "" {
+		t.Errorf("Expected entropy positions to match the trie, got diff (-got,+want) %s", diff)
+	}
+
+	if err := indexed.InsertPageRow(DirectionRight, 0, 0, "abc"); err == nil {
+		t.Error("Expected insert error, got nil")
+	}
+}
@@ -5,158 +5,125 @@ package main
 import (
 	"bytes"
 	_ "embed"
-	"regexp"
 	"strconv"
+	"strings"
 	"syscall/js"
+	"unicode"
 
 	"github.com/regexb/whcypher"
 )
 
-//go:embed source.txt
-var sourceData []byte
-
-var (
-	nonAlphaRegex = regexp.MustCompile(`[^a-zA-Z]`)
-)
-
-func loadSource() [][][]byte {
-	var out [][][]byte
-	groups := bytes.Split(sourceData, []byte("\n\n"))
-	for _, g := range groups {
-		out = append(out, bytes.Split(g, []byte("\n")))
-	}
-	return out
-}
-
-// rowFromSource returns the string of characters walking in the x and y direction
-func rowFromSource(source [][]byte, startX, startY, moveX, moveY int) []byte {
-	row := make([]byte, 0)
-	x, y := startX, startY
-
-	for x >= 0 && x < len(source) && y >= 0 && y < len(source[x]) {
-		row = append(row, source[x][y])
-		x += moveX
-		y += moveY
-	}
-
-	return row
-}
-
-func cypherTreeFromSource(source [][][]byte) *whcypher.Trie {
-	trie := whcypher.NewTrie()
-	for pi, page := range source {
-		for ri, row := range page {
-			for bi := range row {
-				if err := trie.InsertPagePart(whcypher.DirectionRight, pi, ri, bi, string(rowFromSource(page, ri, bi, 0, 1))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionLeft, pi, ri, bi, string(rowFromSource(page, ri, bi, 0, -1))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, 0))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, 0))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionRightDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, 1))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionLeftDown, pi, ri, bi, string(rowFromSource(page, ri, bi, 1, -1))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionRightUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, 1))); err != nil {
-					panic(err)
-				}
-				if err := trie.InsertPagePart(whcypher.DirectionLeftUp, pi, ri, bi, string(rowFromSource(page, ri, bi, -1, -1))); err != nil {
-					panic(err)
-				}
-			}
-		}
-	}
-	return trie
-}
+// index.bin is a compact index of source.txt built ahead of time, so the
+// page can encode as soon as the module loads.
+//
+//go:generate env -u GOOS -u GOARCH go run ../cli --file source.txt --alphabet source --all --compact index build --source_name source.txt --out index.bin
+//go:embed index.bin
+var indexData []byte
 
 type cypherTree struct {
-	source [][][]byte
-	trie   *whcypher.Trie
+	trie *whcypher.Trie
 }
 
 func (c *cypherTree) generate(this js.Value, args []js.Value) any {
-	if len(args) != 3 {
+	if len(args) != 3 && len(args) != 4 {
 		panic("bad args")
 	}
 
-	// Remove non-alpha characters
-	in := nonAlphaRegex.ReplaceAllString(args[0].String(), "")
+	// Remove characters that are not letters. Letters missing from the
+	// source are kept so the encoder reports them instead of dropping them.
+	in := strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, args[0].String())
 
 	algo := args[2].String()
 	direction := whcypher.Direction(args[1].Int())
 
 	println("Query ", in)
 
-	var rawCode [][5]int
-	if algo == "longest" {
-		var err error
-		rawCode, err = c.trie.ConstructPhraseLongest(in, direction)
-		if err != nil {
-			return "error"
+	opts := whcypher.EncodeOptions{}
+	switch algo {
+	case "longest":
+		opts.Strategy = whcypher.StrategyLongest
+	case "optimal":
+		opts.Strategy = whcypher.StrategyOptimal
+	}
+
+	// Optional settings object, e.g. {minLen: 2, maxLen: 5, secure: true}.
+	c.trie.SetLocSelect(firstLocation)
+	if len(args) == 4 && args[3].Type() == js.TypeObject {
+		if v := args[3].Get("secure"); v.Type() == js.TypeBoolean && v.Bool() {
+			c.trie.WithSecureLocSelect()
 		}
-	} else {
-		var err error
-		rawCode, err = c.trie.ConstructPhraseLTR(in, direction)
-		if err != nil {
-			return "error"
+		if v := args[3].Get("minLen"); v.Type() == js.TypeNumber {
+			opts.MinLen = v.Int()
 		}
+		if v := args[3].Get("maxLen"); v.Type() == js.TypeNumber {
+			opts.MaxLen = v.Int()
+		}
+	}
+
+	// Errors are returned as their message, such as the letters missing
+	// from the source, for the page to show.
+	locations, err := c.trie.Encode(in, direction, opts)
+	if err != nil {
+		return err.Error()
 	}
 
-	if len(rawCode) == 0 {
+	if len(locations) == 0 {
 		return "not found"
 	}
 
+	// Pages in the book start at 3, rows and columns at 1.
+	for i := range locations {
+		locations[i] = locations[i].Offset(3, 1, 1)
+	}
+
+	// Codes read only right keep the original format without directions.
+	format := whcypher.CodeFormatV1
+	if direction == whcypher.DirectionRight {
+		format = whcypher.CodeFormatLegacy
+	}
+	code, err := whcypher.FormatCode(locations, format)
+	if err != nil {
+		return err.Error()
+	}
+
 	return js.ValueOf(map[string]interface{}{
-		"output":      rawToCode(rawCode),
-		"debugOutput": rawToDebugString(rawCode),
-		"locations":   rawToJSMap(rawCode),
+		"output":      code,
+		"debugOutput": locationsToDebugString(locations),
+		"locations":   locationsToJSMap(locations),
 	})
 }
 
-func rawToCode(rawCode [][5]int) string {
-	outStr := ""
-	for i, part := range rawCode {
-		outStr += strconv.FormatInt(int64(part[0]+3), 10) + " "
-		outStr += strconv.FormatInt(int64(part[1]+1), 10) + " "
-		outStr += strconv.FormatInt(int64(part[2]+1), 10) + " "
-		outStr += strconv.FormatInt(int64(part[3]), 10)
-
-		if i != len(rawCode)-1 {
-			outStr += " "
-		}
-	}
-	return outStr
+// firstLocation always picks the first candidate, which is the default.
+func firstLocation(n int) int {
+	return 0
 }
 
-func rawToDebugString(rawCode [][5]int) string {
+func locationsToDebugString(locations []whcypher.Location) string {
 	outStr := ""
-	for _, part := range rawCode {
-		outStr += "[" + strconv.FormatInt(int64(part[0]+3), 10) + " "
-		outStr += strconv.FormatInt(int64(part[1]+1), 10) + " "
-		outStr += strconv.FormatInt(int64(part[2]+1), 10) + " "
-		outStr += strconv.FormatInt(int64(part[3]), 10) + " "
-		outStr += dirDebugMap[whcypher.Direction(part[4])] + "]"
+	for _, part := range locations {
+		outStr += "[" + strconv.Itoa(part.Page) + " "
+		outStr += strconv.Itoa(part.Row) + " "
+		outStr += strconv.Itoa(part.Col) + " "
+		outStr += strconv.Itoa(part.Len) + " "
+		outStr += dirDebugMap[part.Dir] + "]"
 	}
 	return outStr
 }
 
-func rawToJSMap(rawCode [][5]int) []any {
+func locationsToJSMap(locations []whcypher.Location) []any {
 	out := []any{}
-	for _, part := range rawCode {
+	for _, part := range locations {
 		out = append(out, map[string]any{
-			"page": part[0] + 3,
-			"row":  part[1] + 1,
-			"col":  part[2] + 1,
-			"len":  part[3],
-			"dir":  whcypher.Direction(part[4]).String(),
+			"page": part.Page,
+			"row":  part.Row,
+			"col":  part.Col,
+			"len":  part.Len,
+			"dir":  part.Dir.String(),
 		})
 	}
 	return out
@@ -175,13 +142,15 @@ var dirDebugMap = map[whcypher.Direction]string{
 
 func main() {
 
-	// Read the file
-	source := loadSource()
-	println("loaded pages: ", len(source))
+	// Load the prebuilt index
+	trie, header, err := whcypher.ReadIndex(bytes.NewReader(indexData))
+	if err != nil {
+		panic(err)
+	}
+	println("loaded index for: ", header.Directions.String())
 
 	cypherGenerator := &cypherTree{
-		trie:   cypherTreeFromSource(source),
-		source: source,
+		trie: trie,
 	}
 
 	js.Global().Set("generateCypher", js.FuncOf(cypherGenerator.generate))
@@ -1,7 +1,10 @@
 package whcypher
 
 import (
+	crand "crypto/rand"
 	"errors"
+	"fmt"
+	"math/big"
 	"math/rand"
 	"strings"
 )
@@ -21,6 +24,7 @@ const (
 
 const (
 	DirectionDiag = DirectionRightUp | DirectionLeftUp | DirectionRightDown | DirectionLeftDown
+	DirectionAll  = DirectionRight | DirectionLeft | DirectionUp | DirectionDown | DirectionDiag
 )
 
 var directionNames map[Direction]string = map[Direction]string{
@@ -65,8 +69,29 @@ func (d Direction) String() string {
 	return strings.Join(dirs, "|")
 }
 
+// ParseDirection parses direction names as produced by Direction.String,
+// e.g. "right" or "right|left-down".
+func ParseDirection(s string) (Direction, error) {
+	var d Direction
+	for _, name := range strings.Split(s, "|") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		found := false
+		for dir, dirName := range directionNames {
+			if dirName == name {
+				d |= dir
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errors.New("invalid direction: " + name)
+		}
+	}
+	return d, nil
+}
+
 type Node struct {
-	Children      [26]*Node
+	Children      []*Node                // indexed by the trie's Alphabet, nil until a child is added
 	LocDirections Direction              // 00001 = right, 00010 = left, 00100 = up, 01000 = down, 10000 = diag
 	KnownLoc      map[Direction][][4]int // [Direction]int[[page, row, col, len], [page, row, col, len]]
 }
@@ -82,7 +107,18 @@ func (n *Node) KnownLocationsForDirections(dir Direction) [][5]int {
 	return locs
 }
 
+// Child returns the child for the letter at index i of the alphabet, or nil.
+func (n *Node) Child(i int) *Node {
+	if n == nil || i < 0 || i >= len(n.Children) {
+		return nil
+	}
+	return n.Children[i]
+}
+
 func (n *Node) AddLoc(dir Direction, page, row, colStart, depth int) {
+	if n.KnownLoc == nil {
+		n.KnownLoc = make(map[Direction][][4]int)
+	}
 	n.KnownLoc[dir] = append(n.KnownLoc[dir], [4]int{page, row, colStart, depth})
 }
 
@@ -93,33 +129,92 @@ func NewNode() *Node {
 }
 
 type Trie struct {
-	RootNode  *Node
-	locSelect func(int) int
+	RootNode *Node
+	alphabet *Alphabet
+	selector LocationSelector
+
+	// built holds every direction inserted so far.
+	built Direction
+	// index, when set, is searched instead of RootNode.
+	index *SuffixIndex
+	// wrap is set when runs wrap around the page edges, and sizes then
+	// holds the rows and columns of every page.
+	wrap  bool
+	sizes [][2]int
 }
 
+// NewTrie returns a trie over AlphabetLatin.
 func NewTrie() *Trie {
-	return &Trie{
+	return NewTrieWithAlphabet(AlphabetLatin)
+}
+
+// NewTrieWithAlphabet returns a trie holding the letters of the alphabet.
+// Sources and phrases may use no other letters.
+func NewTrieWithAlphabet(a *Alphabet) *Trie {
+	t := &Trie{
 		RootNode: NewNode(),
-		locSelect: func(n int) int {
-			return 0
-		},
+		alphabet: a,
 	}
+	t.SetLocSelect(func(n int) int {
+		return 0
+	})
+	return t
+}
+
+// Directions returns the directions inserted into the trie.
+func (t *Trie) Directions() Direction {
+	if t.index != nil {
+		return t.index.Directions()
+	}
+	return t.built
+}
+
+// Alphabet returns the letters the trie holds.
+func (t *Trie) Alphabet() *Alphabet {
+	return t.alphabet
 }
 
+// SetLocSelect chooses between locations knowing only how many there are.
 func (t *Trie) SetLocSelect(f func(int) int) {
-	t.locSelect = f
+	t.selector = LocationSelectorFunc(func(candidates []Location, _ string, _ []Location) int {
+		return f(len(candidates))
+	})
 }
 
 func (t *Trie) WithRandomLocSelect() {
-	t.locSelect = func(n int) int {
+	t.SetLocSelect(func(n int) int {
 		return rand.Intn(n)
-	}
+	})
+}
+
+// WithSeededLocSelect picks locations at random from a generator owned by
+// the trie, so a trie built from the same source and seed returns the same
+// codes for the same sequence of phrases. It must not be used from several
+// goroutines at once.
+func (t *Trie) WithSeededLocSelect(seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	t.SetLocSelect(func(n int) int {
+		return r.Intn(n)
+	})
+}
+
+// WithSecureLocSelect picks locations uniformly at random using crypto/rand,
+// so the choice between locations can not be predicted. It panics if the
+// system random source fails.
+func (t *Trie) WithSecureLocSelect() {
+	t.SetLocSelect(func(n int) int {
+		i, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+		if err != nil {
+			panic("whcypher: reading crypto/rand: " + err.Error())
+		}
+		return int(i.Int64())
+	})
 }
 
 func (t *Trie) InsertPageRow(dir Direction, page, rowNum int, letters string) error {
-	for i := range letters {
-		next := letters[i:]
-		if err := t.InsertPagePart(dir, page, rowNum, i, next); err != nil {
+	row := []rune(letters)
+	for i := range row {
+		if err := t.InsertPagePart(dir, page, rowNum, i, string(row[i:])); err != nil {
 			return err
 		}
 	}
@@ -127,70 +222,136 @@ func (t *Trie) InsertPageRow(dir Direction, page, rowNum int, letters string) er
 }
 
 func (t *Trie) InsertPagePart(dir Direction, page, rowNum, colStart int, letters string) error {
-	current := t.RootNode
-	for i, l := range strings.ToLower(letters) {
-		index := l - 'a' // 99 - lower ascii table decimal number
-		if index < 0 || index > 25 {
-			return errors.New("invalid characters in source: " + string(l))
+	if t.index != nil {
+		return errors.New("can not insert into a trie searching a suffix index")
+	}
+	if t.wrap {
+		return errors.New("can not insert part of a page into a trie that wraps, use InsertSource")
+	}
+	t.built |= dir
+	return t.insertRun(t.RootNode, dir, page, rowNum, colStart, []rune(letters))
+}
+
+// insertRun adds every prefix of the letters below root.
+func (t *Trie) insertRun(root *Node, dir Direction, page, rowNum, colStart int, letters []rune) error {
+	current := root
+	depth := 0
+	for _, l := range letters {
+		index, ok := t.alphabet.Index(l)
+		if !ok {
+			return fmt.Errorf("invalid characters in source: %w", &InvalidCharacterError{Pos: depth, Rune: l})
+		}
+		if current.Children == nil {
+			current.Children = make([]*Node, t.alphabet.Len())
 		}
 		if current.Children[index] == nil {
 			current.Children[index] = NewNode()
 		}
 		current = current.Children[index]
+		depth++
 
 		// then add loc
-		if current != t.RootNode {
+		if current != root {
 			current.LocDirections |= dir
-			current.AddLoc(dir, page, rowNum, colStart, i+1)
+			current.AddLoc(dir, page, rowNum, colStart, depth)
 		}
 	}
 	return nil
 }
 
-// SearchLetters returns the index of the term found up until and all the known locations.
-// If the whole term was found, the index will be len(term)
+// SearchLetters returns the number of letters of the term found and all the known locations.
+// If the whole term was found, the index will be the number of letters in the term.
+// The search stops at the first character outside the alphabet; use ValidatePhrase
+// to report it. Directions that were not built find nothing.
+//
+// Deprecated: Use Search, which returns an error for directions that were not
+// built.
 func (t *Trie) SearchLetters(term string, direction Direction) (int, [][5]int) {
+	return t.searchRunes([]rune(strings.ToLower(term)), direction)
+}
+
+// Search is SearchLetters that returns ErrNoDirection when direction enables
+// none, or a DirectionNotBuiltError when any of them was not built, instead of
+// finding nothing.
+func (t *Trie) Search(term string, direction Direction) (int, [][5]int, error) {
+	return t.searchDir([]rune(strings.ToLower(term)), direction)
+}
+
+// searchDir is Search for a lower case term.
+func (t *Trie) searchDir(term []rune, direction Direction) (int, [][5]int, error) {
+	if err := t.checkSearch(direction); err != nil {
+		return 0, nil, err
+	}
+	n, locs := t.searchRunes(term, direction)
+	return n, locs, nil
+}
+
+// searchRunes is SearchLetters for a lower case term.
+func (t *Trie) searchRunes(term []rune, direction Direction) (int, [][5]int) {
+	n, locs := t.searchNodes(term, direction)
+	if t.wrap {
+		t.markWrapped(locs)
+	}
+	return n, locs
+}
+
+func (t *Trie) searchNodes(term []rune, direction Direction) (int, [][5]int) {
+	if t.index != nil {
+		return t.index.search(term, direction)
+	}
+
 	current := t.RootNode
-	strippedTerm := strings.ToLower(term)
-	for i := 0; i < len(strippedTerm); i++ {
-		index := strippedTerm[i] - 'a'
+	for i, r := range term {
+		index, _ := t.alphabet.Index(r)
+		next := current.Child(index)
 
 		// next letter not found
-		if current == nil || current.Children[index] == nil {
+		if next == nil {
 			return i, current.KnownLocationsForDirections(direction)
 		}
 
 		// next letter in wrong direction
-		if current.Children[index].LocDirections&direction == 0 {
+		if next.LocDirections&direction == 0 {
 			return i, current.KnownLocationsForDirections(direction)
 		}
-		current = current.Children[index]
+		current = next
 	}
-	return len(strippedTerm), current.KnownLocationsForDirections(direction)
+	return len(term), current.KnownLocationsForDirections(direction)
 }
 
 // ConstructPhraseLTR uses a left to right search to find the longest runs of
 // letters it can until the phrase is complete.
 func (t *Trie) ConstructPhraseLTR(phrase string, dir Direction) ([][5]int, error) {
-	if len(phrase) == 0 {
-		return nil, errors.New("invalid phrase: " + phrase)
-	}
-
 	phraseLocations := [][5]int{}
 
 	// Strip down phrase for searching.
-	strippedPhrase := strings.ToLower(strings.ReplaceAll(phrase, " ", ""))
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
 
 	// Use search until the phrase is complete.
 	remaining := strippedPhrase[0:]
 	for len(remaining) > 0 {
-		index, locations := t.SearchLetters(remaining, dir)
+		index, locations, err := t.searchDir(remaining, dir)
+		if err != nil {
+			return nil, err
+		}
 
 		if index < 1 || len(locations) < 1 {
+			if err := t.checkLetters(strippedPhrase, dir); err != nil {
+				return nil, err
+			}
+			if index == len(remaining) {
+				return nil, errors.New("no location found for: " + string(remaining))
+			}
 			return nil, errors.New("letter not found: " + string(remaining[index]))
 		}
-		ri := min(t.locSelect(len(locations)), len(locations)-1)
-		phraseLocations = append(phraseLocations, locations[ri])
+		loc, err := t.pickLocation(locations, string(remaining[:index]), phraseLocations)
+		if err != nil {
+			return nil, err
+		}
+		phraseLocations = append(phraseLocations, loc)
 		remaining = remaining[index:]
 	}
 
@@ -198,23 +359,42 @@ func (t *Trie) ConstructPhraseLTR(phrase string, dir Direction) ([][5]int, error
 }
 
 func (t *Trie) ConstructPhraseLongest(phrase string, dir Direction) ([][5]int, error) {
-	strippedPhrase := strings.ToLower(strings.ReplaceAll(phrase, " ", ""))
-	return t.findAllLongest(strippedPhrase, dir)
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.findAllLongest(strippedPhrase, dir, &[][5]int{})
+	if err != nil {
+		if lerr := t.checkLetters(strippedPhrase, dir); lerr != nil {
+			return nil, lerr
+		}
+		return nil, err
+	}
+	return res, nil
 }
 
-func (t *Trie) findAllLongest(phrase string, dir Direction) (res [][5]int, err error) {
+// findAllLongest covers the phrase around its longest run. chosen collects
+// every location picked so far, in the order they were picked.
+func (t *Trie) findAllLongest(phrase []rune, dir Direction, chosen *[][5]int) (res [][5]int, err error) {
 	if len(phrase) == 0 {
-		return nil, errors.New("invalid phrase: " + phrase)
+		return nil, errors.New("invalid phrase: " + string(phrase))
 	}
 
-	li, ls, lloc := t.FindLongest(phrase, dir)
+	li, ls, lloc, err := t.findLongestDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
 	if len(lloc) == 0 {
-		return nil, errors.New("unable to complete phrase: " + phrase)
+		return nil, errors.New("unable to complete phrase: " + string(phrase))
 	}
 
-	ri := min(t.locSelect(len(lloc)), len(lloc)-1)
+	mainLoc, err := t.pickLocation(lloc, string(phrase[li:li+ls]), *chosen)
+	if err != nil {
+		return nil, err
+	}
+	*chosen = append(*chosen, mainLoc)
 	if len(phrase) == ls {
-		return append(res, lloc[ri]), nil
+		return append(res, mainLoc), nil
 	}
 
 	pre := phrase[0:li]
@@ -222,7 +402,7 @@ func (t *Trie) findAllLongest(phrase string, dir Direction) (res [][5]int, err e
 
 	// Prefix remaining
 	if len(pre) > 0 {
-		prer, prerr := t.findAllLongest(pre, dir)
+		prer, prerr := t.findAllLongest(pre, dir, chosen)
 		if prerr != nil {
 			return nil, prerr
 		}
@@ -230,11 +410,11 @@ func (t *Trie) findAllLongest(phrase string, dir Direction) (res [][5]int, err e
 	}
 
 	// Main
-	res = append(res, lloc[ri])
+	res = append(res, mainLoc)
 
 	// Postfix remaining
 	if len(post) > 0 {
-		posr, poerr := t.findAllLongest(post, dir)
+		posr, poerr := t.findAllLongest(post, dir, chosen)
 		if poerr != nil {
 			return nil, poerr
 		}
@@ -244,10 +424,35 @@ func (t *Trie) findAllLongest(phrase string, dir Direction) (res [][5]int, err e
 	return
 }
 
+// FindLongest returns the letter index and length of the longest run in the
+// phrase, and its locations. Like SearchLetters it finds nothing in directions
+// that were not built.
+//
+// Deprecated: Use FindLongestRun, which returns an error for directions that
+// were not built.
 func (t *Trie) FindLongest(phrase string, dir Direction) (longestIndex int, longestSize int, longestLoc [][5]int) {
+	return t.findLongest([]rune(strings.ToLower(phrase)), dir)
+}
+
+// FindLongestRun is FindLongest that returns the errors of Search instead of
+// finding nothing.
+func (t *Trie) FindLongestRun(phrase string, dir Direction) (longestIndex int, longestSize int, longestLoc [][5]int, err error) {
+	return t.findLongestDir([]rune(strings.ToLower(phrase)), dir)
+}
+
+// findLongestDir is FindLongestRun for a lower case phrase.
+func (t *Trie) findLongestDir(phrase []rune, dir Direction) (longestIndex int, longestSize int, longestLoc [][5]int, err error) {
+	if err := t.checkSearch(dir); err != nil {
+		return 0, 0, nil, err
+	}
+	longestIndex, longestSize, longestLoc = t.findLongest(phrase, dir)
+	return longestIndex, longestSize, longestLoc, nil
+}
+
+func (t *Trie) findLongest(phrase []rune, dir Direction) (longestIndex int, longestSize int, longestLoc [][5]int) {
 	for i := 0; i < len(phrase); i++ {
 		check := phrase[i:]
-		s, loc := t.SearchLetters(check, dir)
+		s, loc := t.searchRunes(check, dir)
 		if s > longestSize {
 			longestIndex = i
 			longestLoc = loc
@@ -259,3 +464,89 @@ func (t *Trie) FindLongest(phrase string, dir Direction) (longestIndex int, long
 	}
 	return
 }
+
+// ConstructPhraseOptimal finds a cover of the phrase using the fewest
+// possible locations. Every prefix of a run found by SearchLetters is itself
+// a run, so the fewest segments from each position can be computed from the
+// end of the phrase backwards.
+func (t *Trie) ConstructPhraseOptimal(phrase string, dir Direction) ([][5]int, error) {
+	strippedPhrase, err := t.preparePhraseDir(phrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	longest, err := t.longestRuns(strippedPhrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	segments, next := fewestSegments(longest, 1, 0)
+
+	phraseLocations := make([][5]int, 0, segments[0])
+	for i := 0; i < len(strippedPhrase); i += next[i] {
+		run := strippedPhrase[i : i+next[i]]
+		_, locations, err := t.searchDir(run, dir)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := t.pickLocation(locations, string(run), phraseLocations)
+		if err != nil {
+			return nil, err
+		}
+		phraseLocations = append(phraseLocations, loc)
+	}
+	return phraseLocations, nil
+}
+
+// longestRuns returns the length of the longest run starting at each
+// position of the phrase.
+func (t *Trie) longestRuns(phrase []rune, dir Direction) ([]int, error) {
+	longest := make([]int, len(phrase))
+	for i := range phrase {
+		var err error
+		longest[i], _, err = t.searchDir(phrase[i:], dir)
+		if err != nil {
+			return nil, err
+		}
+		if longest[i] < 1 {
+			if err := t.checkLetters(phrase, dir); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("letter not found: " + string(phrase[i]))
+		}
+	}
+	return longest, nil
+}
+
+// fewestSegments returns, for each position, the fewest segments covering
+// the rest of the phrase and the length of the first of them, preferring
+// longer first segments. Segments are between minLen and maxLen letters long,
+// where maxLen 0 means no limit. next is 0 where no cover exists.
+func fewestSegments(longest []int, minLen, maxLen int) (segments []int, next []int) {
+	n := len(longest)
+	segments = make([]int, n+1)
+	next = make([]int, n+1)
+	for i := n - 1; i >= 0; i-- {
+		for _, l := range segmentLengths(longest[i], minLen, maxLen) {
+			if i+l < n && next[i+l] == 0 {
+				continue
+			}
+			if next[i] == 0 || segments[i+l]+1 < segments[i] {
+				segments[i] = segments[i+l] + 1
+				next[i] = l
+			}
+		}
+	}
+	return segments, next
+}
+
+// segmentLengths returns the lengths from longest down to minLen that are at
+// most maxLen, where maxLen 0 means no limit.
+func segmentLengths(longest, minLen, maxLen int) []int {
+	if maxLen > 0 {
+		longest = min(longest, maxLen)
+	}
+	lengths := []int{}
+	for l := longest; l >= max(minLen, 1); l-- {
+		lengths = append(lengths, l)
+	}
+	return lengths
+}
@@ -2,12 +2,30 @@ package whcypher
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+// testPage is a page of random letters shared by the tests.
+const testPage = "rmwymndxjjvrwgx\nlyonotvrkanilom\nsrdrrnrbobcsdcu\nmwsearlehfmkcpk\nsfhanaeupzfbslv\n"
+
+// testSource returns a source of testPage followed by the pages given.
+func testSource(t *testing.T, pages ...string) Source {
+	t.Helper()
+	text := testPage
+	for _, page := range pages {
+		text += "\n" + page
+	}
+	source, err := ParseSource(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return source
+}
+
 func TestNode_AddLoc(t *testing.T) {
 	node := NewNode()
 	node.AddLoc(DirectionRight, 1, 2, 3, 4)
@@ -210,6 +228,19 @@ func TestTrie_ConstructPhraseLTR(t *testing.T) {
 	}
 }
 
+func TestTrie_ConstructPhraseLTR_NoLocations(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "ab")
+
+	// A node marked for a direction it holds no locations of, as a corrupt
+	// index could load.
+	trie.RootNode.Child(0).LocDirections |= DirectionLeft
+	trie.built |= DirectionLeft
+	if _, err := trie.ConstructPhraseLTR("a", DirectionLeft); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
 func TestTrie_ConstructPhraseLongest(t *testing.T) {
 	// Define test cases
 	testCases := []struct {
@@ -286,3 +317,191 @@ func TestTrie_ConstructPhraseLongest(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDirection(t *testing.T) {
+	testCases := []struct {
+		input     string
+		expected  Direction
+		expectErr bool
+	}{
+		{input: "right", expected: DirectionRight},
+		{input: "Left-Down", expected: DirectionLeftDown},
+		{input: "right|down|left-up", expected: DirectionRight | DirectionDown | DirectionLeftUp},
+		{input: "sideways", expectErr: true},
+		{input: "", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			d, err := ParseDirection(tc.input)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if d != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, d)
+			}
+			if d.String() != strings.ToLower(tc.input) {
+				t.Errorf("Expected round trip %q, got %q", strings.ToLower(tc.input), d.String())
+			}
+		})
+	}
+}
+
+func TestTrie_ConstructPhraseOptimal(t *testing.T) {
+	// Define test cases
+	testCases := []struct {
+		description string
+		pageRows    []string
+		searchWord  string
+		expected    [][5]int
+		expectedErr error
+	}{
+		{
+			description: "Test case 1",
+			pageRows:    []string{"abc"},
+			searchWord:  "abc",
+			expected:    [][5]int{{0, 0, 0, 3, 1}},
+			expectedErr: nil,
+		},
+		{
+			description: "Empty search",
+			pageRows:    []string{"abc"},
+			searchWord:  "",
+			expected:    nil,
+			expectedErr: errors.ErrUnsupported,
+		},
+		{
+			description: "Missing char",
+			pageRows:    []string{"abc"},
+			searchWord:  "d",
+			expected:    nil,
+			expectedErr: errors.ErrUnsupported,
+		},
+		{
+			description: "Multi row match",
+			pageRows:    []string{"fghooo", "ooabco", "oodeoo"},
+			searchWord:  "abcdefgh",
+			expected:    [][5]int{{0, 1, 2, 3, 1}, {0, 2, 2, 2, 1}, {0, 0, 0, 3, 1}},
+			expectedErr: nil,
+		},
+		{
+			description: "Fewer segments than longest",
+			pageRows:    []string{"bcdefg", "abcooo", "defgho"},
+			searchWord:  "abcdefgh",
+			expected:    [][5]int{{0, 1, 0, 3, 1}, {0, 2, 0, 5, 1}},
+			expectedErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			trie := NewTrie()
+			for i, row := range tc.pageRows {
+				trie.InsertPageRow(DirectionRight, 0, i, row)
+			}
+			result, err := trie.ConstructPhraseOptimal(tc.searchWord, DirectionRight)
+			if err == nil && tc.expectedErr != nil {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if diff := cmp.Diff(result, tc.expected); diff != "" {
+				t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+			}
+		})
+	}
+}
+
+func TestTrie_ConstructPhraseOptimal_NoMoreSegments(t *testing.T) {
+	source, err := ParseSource(strings.NewReader("bcdefg\nabcooo\ndefgho\n\nhgfedc\nzyxwvu\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	trie, err := NewTrieFromSource(source, DirectionAll)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, phrase := range []string{"abcdefgh", "hgfedcba", "we had cabbage", "wave hex"} {
+		optimal, err := trie.ConstructPhraseOptimal(phrase, DirectionAll)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", phrase, err)
+		}
+		ltr, _ := trie.ConstructPhraseLTR(phrase, DirectionAll)
+		longest, _ := trie.ConstructPhraseLongest(phrase, DirectionAll)
+		if len(optimal) > len(ltr) || len(optimal) > len(longest) {
+			t.Errorf("Expected optimal to use the fewest segments for %q, got %d (ltr %d, longest %d)", phrase, len(optimal), len(ltr), len(longest))
+		}
+
+		decoded, err := Decode(source, optimal)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if decoded != strings.ReplaceAll(phrase, " ", "") {
+			t.Errorf("Expected %q to decode, got %q", phrase, decoded)
+		}
+	}
+}
+
+func TestTrie_WithSeededLocSelect(t *testing.T) {
+	source := testSource(t)
+
+	encode := func(seed int64) [][5]int {
+		trie, err := NewTrieFromSource(source, DirectionAll)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		trie.WithSeededLocSelect(seed)
+		result, err := trie.ConstructPhraseLTR("a slow rain on sand", DirectionAll)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return result
+	}
+
+	if diff := cmp.Diff(encode(42), encode(42)); diff != "" {
+		t.Errorf("Expected the same seed to give the same code, got diff (-got,+want) %s", diff)
+	}
+	if cmp.Equal(encode(1), encode(2)) {
+		t.Error("Expected different seeds to give different codes")
+	}
+}
+
+func TestTrie_WithSeededLocSelect_Pinned(t *testing.T) {
+	trie := NewTrie()
+	trie.InsertPageRow(DirectionRight, 0, 0, "abcabcabc")
+	trie.WithSeededLocSelect(7)
+
+	result, err := trie.ConstructPhraseLTR("a a a a", DirectionRight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := [][5]int{{0, 0, 6, 1, 1}, {0, 0, 0, 1, 1}, {0, 0, 0, 1, 1}, {0, 0, 0, 1, 1}}
+	if diff := cmp.Diff(result, expected); diff != "" {
+		t.Errorf("Expected result to match, got diff (-got,+want) %s", diff)
+	}
+}
+
+func TestTrie_WithSecureLocSelect(t *testing.T) {
+	trie := NewTrie()
+	trie.WithSecureLocSelect()
+
+	seen := map[int]int{}
+	for i := 0; i < 300; i++ {
+		n := trie.selectLocation(make([]Location, 3), "", nil)
+		if n < 0 || n >= 3 {
+			t.Fatalf("Expected index in [0, 3), got %d", n)
+		}
+		seen[n]++
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected every index to be picked, got %v", seen)
+	}
+	if n := trie.selectLocation(make([]Location, 1), "", nil); n != 0 {
+		t.Errorf("Expected 0 for a single candidate, got %d", n)
+	}
+}
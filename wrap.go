@@ -0,0 +1,135 @@
+package whcypher
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PageSize returns the number of rows of the page and the letters in each
+// of them. ok is false when the page is out of range or its rows differ in
+// length, as only rectangular pages can be wrapped around.
+func (s Source) PageSize(page int) (rows, cols int, ok bool) {
+	if page < 0 || page >= len(s) || len(s[page]) == 0 {
+		return 0, 0, false
+	}
+	rows, cols = len(s[page]), len(s[page][0])
+	for _, row := range s[page] {
+		if len(row) != cols {
+			return 0, 0, false
+		}
+	}
+	return rows, cols, true
+}
+
+// WalkWrap returns the letters read from page, row and col in a single
+// direction, carrying on from the opposite edge whenever it reaches the edge
+// of the page, until it comes back to its first cell. The page must be
+// rectangular.
+func (s Source) WalkWrap(page, row, col int, dir Direction) []rune {
+	rowStep, colStep, ok := dir.Delta()
+	if !ok {
+		return nil
+	}
+	rows, cols, ok := s.PageSize(page)
+	if !ok || row < 0 || row >= rows || col < 0 || col >= cols {
+		return nil
+	}
+
+	letters := make([]rune, 0, max(rows, cols))
+	r, c := row, col
+	for {
+		letters = append(letters, s[page][r][c])
+		r, c = wrapCell(r+rowStep, rows), wrapCell(c+colStep, cols)
+		if r == row && c == col {
+			return letters
+		}
+	}
+}
+
+// wrapCell folds a row or column index past either edge back onto a page n
+// cells wide.
+func wrapCell(i, n int) int {
+	return ((i % n) + n) % n
+}
+
+// pageSizes returns the rows and columns of every page, failing unless each
+// can be wrapped around.
+func pageSizes(source Source) ([][2]int, error) {
+	sizes := make([][2]int, len(source))
+	for pi, page := range source {
+		if len(page) == 0 {
+			continue
+		}
+		rows, cols, ok := source.PageSize(pi)
+		if !ok {
+			return nil, fmt.Errorf("page %d can not wrap: its rows differ in length", pi)
+		}
+		sizes[pi] = [2]int{rows, cols}
+	}
+	return sizes, nil
+}
+
+// SetWrap makes InsertSource index runs that wrap around the edges of each
+// page, off the right edge onto the left of the same row, off the bottom
+// back onto the top and so on in every direction. A wrapped run stops before
+// it reaches its first cell again. Locations whose runs cross an edge are
+// marked with WrapBit. Every page must be rectangular, and the wrapping can
+// not be changed once anything is inserted.
+func (t *Trie) SetWrap(wrap bool) error {
+	if t.index != nil {
+		return errors.New("can not change wrapping of a trie searching a suffix index")
+	}
+	if t.built != 0 {
+		return errors.New("can not change wrapping of a trie with runs inserted")
+	}
+	t.wrap = wrap
+	return nil
+}
+
+// Wraps reports whether the trie holds runs that wrap around the page edges.
+func (t *Trie) Wraps() bool {
+	return t.wrap
+}
+
+// sourceWalk returns the walk InsertSource indexes: Source.WalkWrap when the
+// trie wraps, after noting the size of every page, or Source.Walk.
+func (t *Trie) sourceWalk(source Source) (func(page, row, col int, dir Direction) []rune, error) {
+	if !t.wrap {
+		return source.Walk, nil
+	}
+	sizes, err := pageSizes(source)
+	if err != nil {
+		return nil, err
+	}
+	t.sizes = sizes
+	return source.WalkWrap, nil
+}
+
+// markWrapped sets WrapBit on every location whose run crosses the edge of
+// its page.
+func (t *Trie) markWrapped(locs [][5]int) {
+	for i, l := range locs {
+		if l[0] < len(t.sizes) && crossesEdge(l, t.sizes[l[0]]) {
+			locs[i][4] |= WrapBit
+		}
+	}
+}
+
+// crossesEdge reports whether reading the location straight on would leave a
+// page of the given rows and columns.
+func crossesEdge(l [5]int, size [2]int) bool {
+	rowStep, colStep, _ := Direction(l[4]).Delta()
+	last := l[3] - 1
+	r, c := l[1]+last*rowStep, l[2]+last*colStep
+	return r < 0 || r >= size[0] || c < 0 || c >= size[1]
+}
+
+// cells is Location.Cells, folding the cells of a wrapped location back onto
+// its page.
+func (t *Trie) cells(loc Location) [][3]int {
+	if loc.Wrap && loc.Page >= 0 && loc.Page < len(t.sizes) {
+		size := t.sizes[loc.Page]
+		return loc.WrapCells(size[0], size[1])
+	}
+	return loc.Cells()
+}
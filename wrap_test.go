@@ -0,0 +1,205 @@
+package whcypher
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSource_WalkWrap(t *testing.T) {
+	source := Source{
+		{
+			[]rune("abcd"),
+			[]rune("efgh"),
+			[]rune("ijkl"),
+		},
+		{
+			[]rune("ab"),
+			[]rune("c"),
+		},
+	}
+
+	testCases := []struct {
+		description string
+		page        int
+		row         int
+		col         int
+		dir         Direction
+		expected    string
+	}{
+		{description: "Right", page: 0, row: 0, col: 2, dir: DirectionRight, expected: "cdab"},
+		{description: "Left", page: 0, row: 1, col: 0, dir: DirectionLeft, expected: "ehgf"},
+		{description: "Up", page: 0, row: 0, col: 3, dir: DirectionUp, expected: "dlh"},
+		{description: "Down", page: 0, row: 2, col: 1, dir: DirectionDown, expected: "jbf"},
+		{description: "Right down", page: 0, row: 2, col: 3, dir: DirectionRightDown, expected: "lafkdejchibg"},
+		{description: "Left up", page: 0, row: 0, col: 0, dir: DirectionLeftUp, expected: "algbihcjedkf"},
+		{description: "Ragged page", page: 1, row: 0, col: 0, dir: DirectionRight},
+		{description: "Out of range", page: 0, row: 3, col: 0, dir: DirectionRight},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result := string(source.WalkWrap(tc.page, tc.row, tc.col, tc.dir))
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func wrapSource(t *testing.T) Source {
+	t.Helper()
+	return testSource(t, "abcd\nefgh\nijkl\n")
+}
+
+func TestTrie_SetWrap(t *testing.T) {
+	source := wrapSource(t)
+	trie := NewTrie()
+	if err := trie.SetWrap(true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := trie.InsertSource(source, DirectionAll); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !trie.Wraps() {
+		t.Error("Expected trie to wrap, got false")
+	}
+
+	// "dab" only exists by running off the right edge of "abcd".
+	index, locations := trie.SearchLetters("dab", DirectionRight)
+	if index != 3 {
+		t.Errorf("Expected length found 3, got %d", index)
+	}
+	if diff := cmp.Diff(locations, [][5]int{{1, 0, 3, 3, int(DirectionRight) | WrapBit}}); diff != "" {
+		t.Errorf("Expected locations to match, got diff (-got,+want) %s", diff)
+	}
+
+	// Runs that stay on the page are not marked.
+	if _, locations := trie.SearchLetters("abc", DirectionRight); locations[0][4] != int(DirectionRight) {
+		t.Errorf("Expected unwrapped location, got %v", locations)
+	}
+
+	// A run never covers a cell twice.
+	if index, _ := trie.SearchLetters("abcda", DirectionRight); index != 4 {
+		t.Errorf("Expected length found 4, got %d", index)
+	}
+
+	phrase := "dab lie hid"
+	for _, opts := range []EncodeOptions{{}, {Strategy: StrategyOptimal}, {NoOverlap: true}} {
+		result, err := trie.Encode(phrase, DirectionAll, opts)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		decoded, err := DecodeLocations(source, result)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if decoded != "dabliehid" {
+			t.Errorf("Expected dabliehid, got %q from %v", decoded, result)
+		}
+	}
+
+	if err := trie.SetWrap(false); err == nil {
+		t.Error("Expected error changing wrap after insert, got nil")
+	}
+	if err := trie.InsertPageRow(DirectionRight, 0, 0, "abc"); err == nil {
+		t.Error("Expected error inserting a row into a trie that wraps, got nil")
+	}
+
+	ragged := NewTrie()
+	ragged.SetWrap(true)
+	if err := ragged.InsertSource(Source{{[]rune("ab"), []rune("c")}}, DirectionRight); err == nil {
+		t.Error("Expected error wrapping a ragged page, got nil")
+	}
+}
+
+func TestSuffixIndex_Wrap(t *testing.T) {
+	source := wrapSource(t)
+	trie := NewTrie()
+	trie.SetWrap(true)
+	if err := trie.InsertSourceParallel(source, DirectionAll, 4); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	index, err := NewWrappedSuffixIndex(source, DirectionAll, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	indexed := NewTrieWithIndex(index)
+	if !indexed.Wraps() {
+		t.Error("Expected index to wrap, got false")
+	}
+
+	terms := []string{"dab", "abcda", "lafkdejchibg", "zzz"}
+	for pi := range source {
+		rows, cols, _ := source.PageSize(pi)
+		for ri := 0; ri < rows; ri++ {
+			for ci := 0; ci < cols; ci++ {
+				for _, d := range DirectionAll.Directions() {
+					run := string(source.WalkWrap(pi, ri, ci, d))
+					terms = append(terms, run, run+run, run[1:]+"x")
+				}
+			}
+		}
+	}
+
+	for _, dir := range []Direction{DirectionRight, DirectionLeft | DirectionDown, DirectionDiag, DirectionAll} {
+		for _, term := range terms {
+			expectedIndex, expectedLocs := trie.SearchLetters(term, dir)
+			index, locs := indexed.SearchLetters(term, dir)
+			if index != expectedIndex {
+				t.Fatalf("Expected %q in %v to match %d letters, got %d", term, dir, expectedIndex, index)
+			}
+			if diff := cmp.Diff(locs, expectedLocs); diff != "" {
+				t.Fatalf("Expected %q in %v locations to match, got diff (-got,+want) %s", term, dir, diff)
+			}
+		}
+	}
+}
+
+func TestTrie_WriteIndex_Wrap(t *testing.T) {
+	source := wrapSource(t)
+	trie := NewTrie()
+	trie.SetWrap(true)
+	if err := trie.InsertSource(source, DirectionRight|DirectionUp); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	index, err := NewWrappedSuffixIndex(source, DirectionRight|DirectionUp, AlphabetLatin)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for name, trie := range map[string]*Trie{"Trie": trie, "Index": NewTrieWithIndex(index)} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := trie.WriteIndex(&buf, source, ""); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			loaded, header, err := ReadIndex(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !header.Wrap || !loaded.Wraps() {
+				t.Errorf("Expected loaded index to wrap, got %v and %v", header.Wrap, loaded.Wraps())
+			}
+
+			phrase := "dab hal"
+			expected, err := trie.EncodeOptimal(phrase, DirectionRight|DirectionUp)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			result, err := loaded.EncodeOptimal(phrase, DirectionRight|DirectionUp)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if diff := cmp.Diff(result, expected); diff != "" {
+				t.Errorf("Expected loaded index to encode the same, got diff (-got,+want) %s", diff)
+			}
+			if trie.index != nil {
+				if diff := cmp.Diff(loaded.index.arrays, trie.index.arrays, cmp.AllowUnexported(suffixArray{})); diff != "" {
+					t.Errorf("Expected loaded suffix arrays to match, got diff (-got,+want) %s", diff)
+				}
+			}
+		})
+	}
+}